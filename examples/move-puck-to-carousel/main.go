@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -15,6 +16,11 @@ type SensorResponse struct {
 	Value bool `json:"value"`
 }
 
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 func main() {
 	// test connection to server
 	resp, err := http.Get(fmt.Sprintf("%s/tp/ping", serverURL))
@@ -52,8 +58,15 @@ func main() {
 		panic(err)
 	}
 	if resp.StatusCode != 200 {
-		respString, _ := io.ReadAll(resp.Body)
-		panic(string(respString))
+		var errResp ErrorResponse
+		err = json.NewDecoder(resp.Body).Decode(&errResp)
+		if err != nil {
+			panic(err)
+		}
+		// puck left on start from previous run is fine too
+		if errResp.Code != "slot_occupied" {
+			panic(errResp.Message)
+		}
 	}
 
 	// move gripper down
@@ -131,30 +144,14 @@ func main() {
 		panic(string(respString))
 	}
 
-	for {
-		// get gripper carousel pos value
-		resp, err = http.Get(fmt.Sprintf("%s/tp/sensor/%s", serverURL, "ns:1, i:1"))
-		if err != nil {
-			panic(err)
-		}
-		if resp.StatusCode != 200 {
-			respString, _ := io.ReadAll(resp.Body)
-			panic(string(respString))
-		}
-
-		// parse sensor response
-		var sensCarousel SensorResponse
-		err = json.NewDecoder(resp.Body).Decode(&sensCarousel)
-		if err != nil {
-			panic(err)
-		}
-
-		// if gripper not in carousel pos wait and then repeat
-		if sensCarousel.Value {
-			break
-		} else {
-			time.Sleep(time.Millisecond)
-		}
+	// wait on server side until gripper reaches carousel pos
+	resp, err = http.Get(fmt.Sprintf("%s/tp/wait?sensor=%s&value=true&timeout=10s", serverURL, url.QueryEscape("ns:1, i:1")))
+	if err != nil {
+		panic(err)
+	}
+	if resp.StatusCode != 200 {
+		respString, _ := io.ReadAll(resp.Body)
+		panic(string(respString))
 	}
 
 	// stop gripper
@@ -14,6 +14,10 @@ func New(name, addr string) *Actuator {
 	}
 }
 
+func (s *Actuator) GetName() string {
+	return s.name
+}
+
 func (s *Actuator) IsActivated() bool {
 	return s.isActivated
 }
@@ -0,0 +1,175 @@
+package rest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+type PuckCycle struct {
+	PuckId       int        `json:"puckId"`
+	Color        string     `json:"color"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	SortedAt     *time.Time `json:"sortedAt"`
+	CycleTimeSec *float64   `json:"cycleTimeSec"`
+}
+
+type StationReport struct {
+	Station      string             `json:"station"`
+	StateTimeSec map[string]float64 `json:"stateTimeSec"`
+	Utilization  float64            `json:"utilization"`
+}
+
+type AnalyticsResponse struct {
+	WindowStart       time.Time       `json:"windowStart"`
+	WindowEnd         time.Time       `json:"windowEnd"`
+	IsRunning         bool            `json:"isRunning"`
+	Sorted            int             `json:"sorted"`
+	Lost              int             `json:"lost"`
+	Scrapped          int             `json:"scrapped"`
+	AvgCycleTimeSec   float64         `json:"avgCycleTimeSec"`
+	IdealCycleTimeSec float64         `json:"idealCycleTimeSec"`
+	ThroughputPerHour float64         `json:"throughputPerHour"`
+	FaultTimeSec      float64         `json:"faultTimeSec"`
+	Availability      float64         `json:"availability"`
+	Performance       float64         `json:"performance"`
+	Quality           float64         `json:"quality"`
+	OEE               float64         `json:"oee"`
+	Stations          []StationReport `json:"stations"`
+	Pucks             []PuckCycle     `json:"pucks"`
+}
+
+func NewAnalyticsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := s.GetAnalytics()
+
+		resp := AnalyticsResponse{
+			WindowStart:       report.WindowStart,
+			WindowEnd:         report.WindowEnd,
+			IsRunning:         report.IsRunning,
+			Sorted:            report.Sorted,
+			Lost:              report.Lost,
+			Scrapped:          report.Scrapped,
+			AvgCycleTimeSec:   report.AvgCycleTime.Seconds(),
+			IdealCycleTimeSec: report.IdealCycleTime.Seconds(),
+			ThroughputPerHour: report.Throughput,
+			FaultTimeSec:      report.FaultTime.Seconds(),
+			Availability:      report.Availability,
+			Performance:       report.Performance,
+			Quality:           report.Quality,
+			OEE:               report.OEE,
+			Stations:          make([]StationReport, 0, len(report.Stations)),
+			Pucks:             make([]PuckCycle, 0, len(report.Pucks)),
+		}
+
+		for _, st := range report.Stations {
+			stationResp := StationReport{
+				Station:      st.Station,
+				StateTimeSec: make(map[string]float64),
+				Utilization:  st.Utilization,
+			}
+			for state, t := range st.StateTime {
+				stationResp.StateTimeSec[state] = t.Seconds()
+			}
+			resp.Stations = append(resp.Stations, stationResp)
+		}
+
+		for _, p := range report.Pucks {
+			puckResp := PuckCycle{
+				PuckId:    p.PuckId,
+				Color:     p.Color,
+				CreatedAt: p.CreatedAt,
+				SortedAt:  p.SortedAt,
+			}
+			if cycleTime, ok := p.CycleTime(); ok {
+				sec := cycleTime.Seconds()
+				puckResp.CycleTimeSec = &sec
+			}
+			resp.Pucks = append(resp.Pucks, puckResp)
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewAnalyticsPucksCSVHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := s.GetAnalytics()
+
+		rows := [][]string{{"puck_id", "color", "created_at", "sorted_at", "cycle_time_sec"}}
+		for _, p := range report.Pucks {
+			sortedAt, cycleTimeSec := "", ""
+			if cycleTime, ok := p.CycleTime(); ok {
+				sortedAt = p.SortedAt.Format(time.RFC3339Nano)
+				cycleTimeSec = strconv.FormatFloat(cycleTime.Seconds(), 'f', 3, 64)
+			}
+			rows = append(rows, []string{
+				strconv.Itoa(p.PuckId),
+				p.Color,
+				p.CreatedAt.Format(time.RFC3339Nano),
+				sortedAt,
+				cycleTimeSec,
+			})
+		}
+
+		writeCSV(w, log, "pucks.csv", rows)
+	}
+}
+
+func NewAnalyticsStationsCSVHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := s.GetAnalytics()
+
+		states := []string{core.StationStateBusy, core.StationStateIdle, core.StationStateBlocked, core.StationStateStarved}
+
+		header := []string{"station"}
+		for _, state := range states {
+			header = append(header, state+"_sec")
+		}
+		header = append(header, "utilization")
+
+		rows := [][]string{header}
+		for _, st := range report.Stations {
+			row := []string{st.Station}
+			for _, state := range states {
+				row = append(row, strconv.FormatFloat(st.StateTime[state].Seconds(), 'f', 3, 64))
+			}
+			row = append(row, strconv.FormatFloat(st.Utilization, 'f', 4, 64))
+			rows = append(rows, row)
+		}
+
+		writeCSV(w, log, "stations.csv", rows)
+	}
+}
+
+func NewAnalyticsStartHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.StartAnalytics()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewAnalyticsStopHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.StopAnalytics()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func writeCSV(w http.ResponseWriter, log *slog.Logger, filename string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+
+	if err := csv.NewWriter(w).WriteAll(rows); err != nil {
+		log.Error("cannot write csv", "error", err)
+	}
+}
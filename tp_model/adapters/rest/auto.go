@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/auto"
+)
+
+type AutoStatusResponse struct {
+	Running          bool       `json:"running"`
+	Step             string     `json:"step,omitempty"`
+	Cycles           int        `json:"cycles"`
+	StartedAt        *time.Time `json:"startedAt,omitempty"`
+	LastCycleTimeSec float64    `json:"lastCycleTimeSec"`
+	LastError        string     `json:"lastError,omitempty"`
+}
+
+func NewAutoStatusHandler(log *slog.Logger, c *auto.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := c.Status()
+
+		resp := AutoStatusResponse{
+			Running:          status.Running,
+			Step:             status.Step,
+			Cycles:           status.Cycles,
+			StartedAt:        status.StartedAt,
+			LastCycleTimeSec: status.LastCycleTime.Seconds(),
+		}
+		if status.LastError != nil {
+			resp.LastError = status.LastError.Error()
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewAutoStartHandler(log *slog.Logger, c *auto.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := c.Start()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewAutoStopHandler(log *slog.Logger, c *auto.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := c.Stop()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
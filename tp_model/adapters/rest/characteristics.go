@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+const encoderPathName = "encoder_id"
+
+type SensorCharacteristics struct {
+	DelayMs    int64   `json:"delayMs"`
+	Hysteresis float64 `json:"hysteresis"` // m
+	BounceMs   int64   `json:"bounceMs"`
+}
+
+type EncoderCharacteristics struct {
+	Resolution float64 `json:"resolution"` // m per count
+	Noise      float64 `json:"noise"`      // m, standard deviation
+}
+
+type GetEncoderResponse struct {
+	Value    int64   `json:"value"`    // counts
+	Position float64 `json:"position"` // m, value times resolution
+}
+
+func NewSensorCharacteristicsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sensorId := r.PathValue(sensorPathName)
+
+		c, err := s.GetSensorCharacteristics(sensorId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"sensorId": sensorId})
+			return
+		}
+
+		resp := SensorCharacteristics{
+			DelayMs:    c.Delay.Milliseconds(),
+			Hysteresis: c.Hysteresis,
+			BounceMs:   c.Bounce.Milliseconds(),
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// replaces all characteristics of sensor, zero ones make it ideal
+func NewSetSensorCharacteristicsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sensorId := r.PathValue(sensorPathName)
+
+		var req SensorCharacteristics
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode sensor characteristics: %s", err.Error()))
+			return
+		}
+
+		c := core.SensorCharacteristics{
+			Delay:      time.Duration(req.DelayMs) * time.Millisecond,
+			Hysteresis: req.Hysteresis,
+			Bounce:     time.Duration(req.BounceMs) * time.Millisecond,
+		}
+		if err := s.SetSensorCharacteristics(sensorId, c); err != nil {
+			writeError(w, log, err, map[string]any{"sensorId": sensorId})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewEncoderHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoderId := r.PathValue(encoderPathName)
+
+		value, err := s.GetEncoderValue(encoderId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"encoderId": encoderId})
+			return
+		}
+		c, err := s.GetEncoderCharacteristics(encoderId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"encoderId": encoderId})
+			return
+		}
+
+		resp := GetEncoderResponse{Value: value, Position: float64(value) * c.Resolution}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewEncoderCharacteristicsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoderId := r.PathValue(encoderPathName)
+
+		c, err := s.GetEncoderCharacteristics(encoderId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"encoderId": encoderId})
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(EncoderCharacteristics(c)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewSetEncoderCharacteristicsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoderId := r.PathValue(encoderPathName)
+
+		var req EncoderCharacteristics
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode encoder characteristics: %s", err.Error()))
+			return
+		}
+
+		if err := s.SetEncoderCharacteristics(encoderId, core.EncoderCharacteristics(req)); err != nil {
+			writeError(w, log, err, map[string]any{"encoderId": encoderId})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+const (
+	controlTokenHeader = "X-Control-Token"
+	teacherKeyHeader   = "X-Teacher-Key"
+)
+
+// rejects commands of clients not owning line control, lets everyone through if control is free
+func RequireControl(log *slog.Logger, s *core.Service, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.CheckControl(r.Header.Get(controlTokenHeader))
+		if err != nil {
+			details := map[string]any{}
+			if lease, held := s.GetControl(); held {
+				details["owner"] = lease.Owner
+				details["expiresAt"] = lease.ExpiresAt
+			}
+			writeError(w, log, err, details)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+type ControlRequest struct {
+	Owner string `json:"owner"`
+}
+
+type ControlResponse struct {
+	IsHeld    bool       `json:"isHeld"`
+	Owner     string     `json:"owner,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type ControlLeaseResponse struct {
+	Token     string    `json:"token"`
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func NewControlHandler(s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := ControlResponse{}
+		if lease, held := s.GetControl(); held {
+			resp.IsHeld = true
+			resp.Owner = lease.Owner
+			resp.ExpiresAt = &lease.ExpiresAt
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func NewControlAcquireHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return newControlGrantHandler(log, s.AcquireControl)
+}
+
+// teacher override, takes control from current owner
+func NewControlSeizeHandler(log *slog.Logger, s *core.Service, teacherKey string) http.HandlerFunc {
+	grant := newControlGrantHandler(log, s.SeizeControl)
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(teacherKeyHeader)
+		if teacherKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(teacherKey)) != 1 {
+			writeErrorResponse(w, log, http.StatusForbidden, ErrorResponse{
+				Code:    CodeForbidden,
+				Message: "valid teacher key is required",
+			})
+			return
+		}
+
+		grant(w, r)
+	}
+}
+
+func newControlGrantHandler(log *slog.Logger, grant func(owner string) (core.ControlLease, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ControlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode control request: %s", err.Error()))
+			return
+		}
+		if req.Owner == "" {
+			req.Owner = r.RemoteAddr
+		}
+
+		lease, err := grant(req.Owner)
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		writeLease(w, log, lease)
+	}
+}
+
+func NewControlHeartbeatHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lease, err := s.HeartbeatControl(r.Header.Get(controlTokenHeader))
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		writeLease(w, log, lease)
+	}
+}
+
+func NewControlReleaseHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.ReleaseControl(r.Header.Get(controlTokenHeader))
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func writeLease(w http.ResponseWriter, log *slog.Logger, lease core.ControlLease) {
+	resp := ControlLeaseResponse{
+		Token:     lease.Token,
+		Owner:     lease.Owner,
+		ExpiresAt: lease.ExpiresAt,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error("cannot encode reply", "error", err)
+	}
+}
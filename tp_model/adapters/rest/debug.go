@@ -0,0 +1,148 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+const breakpointPathName = "breakpoint_id"
+
+type Breakpoint struct {
+	Id        int        `json:"id"`
+	Condition string     `json:"condition"`
+	Hits      int        `json:"hits"`
+	LastHitAt *time.Time `json:"lastHitAt,omitempty"`
+}
+
+type CreateBreakpointRequest struct {
+	Condition string `json:"condition"` // like: gripper_down and carousel_rotating
+}
+
+type SimulationStatusResponse struct {
+	Paused     bool        `json:"paused"`
+	PausedAt   *time.Time  `json:"pausedAt,omitempty"`
+	Reason     string      `json:"reason,omitempty"` // manual, breakpoint or step
+	Breakpoint *Breakpoint `json:"breakpoint,omitempty"`
+	StepTicks  int         `json:"stepTicks,omitempty"`
+}
+
+func NewBreakpointsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		breakpoints := s.GetBreakpoints()
+
+		resp := make([]Breakpoint, 0, len(breakpoints))
+		for _, bp := range breakpoints {
+			resp = append(resp, Breakpoint(bp))
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewCreateBreakpointHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateBreakpointRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode breakpoint: %s", err.Error()))
+			return
+		}
+
+		bp, err := s.AddBreakpoint(req.Condition)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"condition": req.Condition})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(Breakpoint(bp)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewDeleteBreakpointHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue(breakpointPathName))
+		if err != nil {
+			writeBadRequest(w, log, "breakpoint id should be integer")
+			return
+		}
+
+		if err := s.DeleteBreakpoint(id); err != nil {
+			writeError(w, log, err, map[string]any{"breakpointId": id})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewSimulationStatusHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := s.GetSimulationStatus()
+
+		resp := SimulationStatusResponse{
+			Paused:    status.Paused,
+			PausedAt:  status.PausedAt,
+			Reason:    status.Reason,
+			StepTicks: status.StepTicks,
+		}
+		if status.Breakpoint != nil {
+			bp := Breakpoint(*status.Breakpoint)
+			resp.Breakpoint = &bp
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewSimulationPauseHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.PauseSimulation()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewSimulationResumeHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.ResumeSimulation(); err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// runs paused simulation for ?ticks=n ticks, one by default
+func NewSimulationStepHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticks := 1
+		if param := r.URL.Query().Get("ticks"); param != "" {
+			var err error
+			ticks, err = strconv.Atoi(param)
+			if err != nil {
+				writeBadRequest(w, log, "ticks should be integer")
+				return
+			}
+		}
+
+		if err := s.StepSimulation(ticks); err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
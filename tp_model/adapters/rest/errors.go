@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Razzle131/line316/tp_model/auto"
+	"github.com/Razzle131/line316/tp_model/core"
+	"github.com/Razzle131/line316/tp_model/exercise"
+	"github.com/Razzle131/line316/tp_model/gym"
+	"github.com/Razzle131/line316/tp_model/lines"
+	"github.com/Razzle131/line316/tp_model/planner"
+	"github.com/Razzle131/line316/tp_model/plc"
+	"github.com/Razzle131/line316/tp_model/st"
+)
+
+// stable error codes, clients should branch on them instead of messages
+const (
+	CodeBadRequest           = "bad_request"
+	CodeForbidden            = "forbidden"
+	CodeInternal             = "internal"
+	CodeGripperAlreadyMoving = "gripper_already_moving"
+	CodeGripperStopping      = "gripper_stopping"
+	CodeGripperClosed        = "gripper_closed"
+	CodeGripperNotDown       = "gripper_not_down"
+	CodeNoStationAtPosition  = "no_station_at_position"
+	CodeTakeFromSorting      = "take_from_sorting"
+	CodeSlotOccupied         = "slot_occupied"
+	CodeSlotEmpty            = "slot_empty"
+	CodeBadSlotParam         = "bad_slot_param"
+	CodeStationAborted       = "station_aborted"
+	CodePuckPackaged         = "puck_packaged"
+	CodePuckNotPackaged      = "puck_not_packaged"
+	CodeSensorNotFound       = "sensor_not_found"
+	CodeEncoderNotFound      = "encoder_not_found"
+	CodeSensorInvalid        = "sensor_characteristics_invalid"
+	CodeMotionInvalid        = "motion_profile_invalid"
+	CodeActuatorNotFound     = "actuator_not_found"
+	CodeAlarmNotFound        = "alarm_not_found"
+	CodeWaitTimeout          = "wait_timeout"
+	CodeSnapshotInvalid      = "snapshot_invalid"
+	CodeLineBusy             = "line_busy"
+	CodeLineNotFound         = "line_not_found"
+	CodeTooManyLines         = "too_many_lines"
+	CodeControlTaken         = "control_taken"
+	CodeControlDenied        = "control_denied"
+	CodeOrderInvalid         = "order_invalid"
+	CodeOrderNotFound        = "order_not_found"
+	CodeOrderClosed          = "order_closed"
+	CodeNoActiveOrder        = "no_active_order"
+	CodeAutoRunning          = "auto_running"
+	CodeAutoNotRunning       = "auto_not_running"
+	CodeExerciseNotFound     = "exercise_not_found"
+	CodeExerciseRunning      = "exercise_running"
+	CodeNoExercise           = "no_exercise"
+	CodeUnknownAction        = "unknown_action"
+	CodeEnvNotReset          = "env_not_reset"
+	CodeEpisodeDone          = "episode_done"
+	CodeEnvNotFound          = "env_not_found"
+	CodeTooManyEnvs          = "too_many_envs"
+	CodeEnvConfigInvalid     = "env_config_invalid"
+	CodeGoalInvalid          = "goal_invalid"
+	CodeNoPlan               = "no_plan"
+	CodeUnknownStep          = "unknown_step"
+	CodeControllerNotFound   = "controller_not_found"
+	CodePLCRunning           = "plc_running"
+	CodePLCNotRunning        = "plc_not_running"
+	CodeSTCompile            = "st_compile_error"
+	CodeTraceOptionsInvalid  = "trace_options_invalid"
+	CodeBreakpointInvalid    = "breakpoint_invalid"
+	CodeBreakpointNotFound   = "breakpoint_not_found"
+	CodeNotPaused            = "not_paused"
+	CodeSimulationPaused     = "simulation_paused"
+	CodeBadStep              = "bad_step"
+	CodeNoSTProgram          = "no_st_program"
+	CodeHistoryDisabled      = "history_disabled"
+	CodeStateNotRecorded     = "state_not_recorded"
+)
+
+type ErrorResponse struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+var errorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{core.ErrGripperAlreadyMoving, CodeGripperAlreadyMoving, http.StatusConflict},
+	{core.ErrGripperWantToStop, CodeGripperStopping, http.StatusConflict},
+	{core.ErrGripperClosed, CodeGripperClosed, http.StatusUnprocessableEntity},
+	{core.ErrGripperNotDown, CodeGripperNotDown, http.StatusUnprocessableEntity},
+	{core.ErrNoStationAtPosition, CodeNoStationAtPosition, http.StatusUnprocessableEntity},
+	{core.ErrTakeFromSorting, CodeTakeFromSorting, http.StatusUnprocessableEntity},
+	{core.ErrSlotOccupied, CodeSlotOccupied, http.StatusConflict},
+	{core.ErrSlotEmpty, CodeSlotEmpty, http.StatusUnprocessableEntity},
+	{core.ErrBadSlotParam, CodeBadSlotParam, http.StatusBadRequest},
+	{core.ErrStationAborted, CodeStationAborted, http.StatusConflict},
+	{core.ErrPuckPackaged, CodePuckPackaged, http.StatusUnprocessableEntity},
+	{core.ErrPuckNotPackaged, CodePuckNotPackaged, http.StatusUnprocessableEntity},
+	{core.ErrSensorNotFound, CodeSensorNotFound, http.StatusNotFound},
+	{core.ErrEncoderNotFound, CodeEncoderNotFound, http.StatusNotFound},
+	{core.ErrSensorCharacteristicsInvalid, CodeSensorInvalid, http.StatusBadRequest},
+	{core.ErrMotionProfileInvalid, CodeMotionInvalid, http.StatusBadRequest},
+	{core.ErrActuatorNotFound, CodeActuatorNotFound, http.StatusNotFound},
+	{core.ErrAlarmNotFound, CodeAlarmNotFound, http.StatusNotFound},
+	{core.ErrWaitTimeout, CodeWaitTimeout, http.StatusGatewayTimeout},
+	{core.ErrSnapshotInvalid, CodeSnapshotInvalid, http.StatusUnprocessableEntity},
+	{core.ErrLineBusy, CodeLineBusy, http.StatusConflict},
+	{lines.ErrLineNotFound, CodeLineNotFound, http.StatusNotFound},
+	{lines.ErrTooManyLines, CodeTooManyLines, http.StatusServiceUnavailable},
+	{core.ErrControlTaken, CodeControlTaken, http.StatusConflict},
+	{core.ErrNotControlOwner, CodeControlDenied, http.StatusForbidden},
+	{core.ErrOrderInvalid, CodeOrderInvalid, http.StatusUnprocessableEntity},
+	{core.ErrOrderNotFound, CodeOrderNotFound, http.StatusNotFound},
+	{core.ErrOrderClosed, CodeOrderClosed, http.StatusConflict},
+	{core.ErrNoActiveOrder, CodeNoActiveOrder, http.StatusNotFound},
+	{auto.ErrAlreadyRunning, CodeAutoRunning, http.StatusConflict},
+	{auto.ErrNotRunning, CodeAutoNotRunning, http.StatusConflict},
+	{exercise.ErrExerciseNotFound, CodeExerciseNotFound, http.StatusNotFound},
+	{exercise.ErrExerciseRunning, CodeExerciseRunning, http.StatusConflict},
+	{exercise.ErrNoExercise, CodeNoExercise, http.StatusNotFound},
+	{gym.ErrUnknownAction, CodeUnknownAction, http.StatusBadRequest},
+	{gym.ErrNotReset, CodeEnvNotReset, http.StatusConflict},
+	{gym.ErrEpisodeDone, CodeEpisodeDone, http.StatusConflict},
+	{gym.ErrEnvNotFound, CodeEnvNotFound, http.StatusNotFound},
+	{gym.ErrTooManyEnvs, CodeTooManyEnvs, http.StatusServiceUnavailable},
+	{gym.ErrConfigInvalid, CodeEnvConfigInvalid, http.StatusBadRequest},
+	{planner.ErrGoalInvalid, CodeGoalInvalid, http.StatusUnprocessableEntity},
+	{planner.ErrNoPlan, CodeNoPlan, http.StatusUnprocessableEntity},
+	{auto.ErrUnknownStep, CodeUnknownStep, http.StatusBadRequest},
+	{plc.ErrControllerNotFound, CodeControllerNotFound, http.StatusNotFound},
+	{plc.ErrAlreadyRunning, CodePLCRunning, http.StatusConflict},
+	{plc.ErrNotRunning, CodePLCNotRunning, http.StatusConflict},
+	{st.ErrCompile, CodeSTCompile, http.StatusUnprocessableEntity},
+	{st.ErrNoProgram, CodeNoSTProgram, http.StatusNotFound},
+	{core.ErrTraceOptionsInvalid, CodeTraceOptionsInvalid, http.StatusBadRequest},
+	{core.ErrBreakpointInvalid, CodeBreakpointInvalid, http.StatusBadRequest},
+	{core.ErrBreakpointNotFound, CodeBreakpointNotFound, http.StatusNotFound},
+	{core.ErrNotPaused, CodeNotPaused, http.StatusConflict},
+	{core.ErrSimulationPaused, CodeSimulationPaused, http.StatusConflict},
+	{core.ErrBadStep, CodeBadStep, http.StatusBadRequest},
+	{core.ErrHistoryDisabled, CodeHistoryDisabled, http.StatusNotFound},
+	{core.ErrStateNotRecorded, CodeStateNotRecorded, http.StatusNotFound},
+}
+
+// returns error code and http status for error from core
+func errorCode(err error) (string, int) {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code, c.status
+		}
+	}
+	return CodeInternal, http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, log *slog.Logger, err error, details map[string]any) {
+	code, status := errorCode(err)
+	writeErrorResponse(w, log, status, ErrorResponse{
+		Code:    code,
+		Message: err.Error(),
+		Details: details,
+	})
+}
+
+func writeBadRequest(w http.ResponseWriter, log *slog.Logger, message string) {
+	writeErrorResponse(w, log, http.StatusBadRequest, ErrorResponse{
+		Code:    CodeBadRequest,
+		Message: message,
+	})
+}
+
+func writeErrorResponse(w http.ResponseWriter, log *slog.Logger, status int, resp ErrorResponse) {
+	if rec, ok := w.(*codeRecorder); ok {
+		rec.code = resp.Code
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error("cannot encode error reply", "error", err)
+	}
+}
@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/exercise"
+)
+
+const exercisePathName = "exercise_name"
+
+type ExerciseResponse struct {
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	TimeLimitSec float64 `json:"timeLimitSec"`
+	Seed         *int64  `json:"seed,omitempty"`
+}
+
+type Criterion struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Points int    `json:"points"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type ExerciseReportResponse struct {
+	Exercise   string      `json:"exercise"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt"`
+	IsRunning  bool        `json:"isRunning"`
+	TimedOut   bool        `json:"timedOut"`
+	Score      int         `json:"score"`
+	MaxScore   int         `json:"maxScore"`
+	Passed     bool        `json:"passed"`
+	Criteria   []Criterion `json:"criteria"`
+}
+
+func NewExercisesHandler(log *slog.Logger, c *exercise.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		exercises := c.List()
+
+		resp := make([]ExerciseResponse, 0, len(exercises))
+		for _, ex := range exercises {
+			resp = append(resp, ExerciseResponse{
+				Name:         ex.Name,
+				Description:  ex.Description,
+				TimeLimitSec: ex.TimeLimit.Seconds(),
+				Seed:         ex.Seed,
+			})
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewExerciseStartHandler(log *slog.Logger, runner *exercise.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue(exercisePathName)
+		if name == "" {
+			writeBadRequest(w, log, "missing exercise name field")
+			return
+		}
+
+		report, err := runner.Start(name)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"exercise": name})
+			return
+		}
+
+		writeExerciseReport(w, log, report)
+	}
+}
+
+func NewExerciseFinishHandler(log *slog.Logger, runner *exercise.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := runner.Finish()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		writeExerciseReport(w, log, report)
+	}
+}
+
+func NewExerciseReportHandler(log *slog.Logger, runner *exercise.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := runner.Report()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		writeExerciseReport(w, log, report)
+	}
+}
+
+func writeExerciseReport(w http.ResponseWriter, log *slog.Logger, report exercise.Report) {
+	resp := ExerciseReportResponse{
+		Exercise:   report.Exercise,
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+		IsRunning:  report.FinishedAt == nil,
+		TimedOut:   report.TimedOut,
+		Score:      report.Score,
+		MaxScore:   report.MaxScore,
+		Passed:     report.Passed,
+		Criteria:   make([]Criterion, 0, len(report.Criteria)),
+	}
+
+	for _, c := range report.Criteria {
+		resp.Criteria = append(resp.Criteria, Criterion{
+			Name:   c.Name,
+			Passed: c.Passed,
+			Points: c.Points,
+			Detail: c.Detail,
+		})
+	}
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error("cannot encode reply", "error", err)
+	}
+}
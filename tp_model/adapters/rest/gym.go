@@ -0,0 +1,254 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/gym"
+)
+
+const envPathName = "env_id"
+
+type GymRewards struct {
+	Sorted float64 `json:"sorted"`
+	Error  float64 `json:"error"`
+	Alarm  float64 `json:"alarm"`
+	Step   float64 `json:"step"`
+}
+
+type CreateEnvRequest struct {
+	TicksPerStep int         `json:"ticksPerStep"` // up to 6000
+	MaxSteps     int         `json:"maxSteps"`     // up to 1000000
+	Rewards      *GymRewards `json:"rewards"`
+}
+
+type EnvResponse struct {
+	Id           string     `json:"id"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	TicksPerStep int        `json:"ticksPerStep"`
+	MaxSteps     int        `json:"maxSteps"`
+	Rewards      GymRewards `json:"rewards"`
+}
+
+type GymSpaceResponse struct {
+	Actions     []string `json:"actions"`
+	Observation []string `json:"observation"`
+}
+
+type ResetEnvRequest struct {
+	Seed int64 `json:"seed"`
+}
+
+// action is given either by name or by number
+type StepEnvRequest struct {
+	Action     *int   `json:"action"`
+	ActionName string `json:"actionName"`
+}
+
+type ObservationResponse struct {
+	Observation []float64 `json:"observation"`
+	TimeSec     float64   `json:"timeSec"`
+}
+
+type StepEnvResponse struct {
+	ObservationResponse
+	Reward    float64 `json:"reward"`
+	Done      bool    `json:"done"`
+	Truncated bool    `json:"truncated"`
+	Error     string  `json:"error,omitempty"`
+	Sorted    int     `json:"sorted"`
+}
+
+func newEnvResponse(entry *gym.Entry) EnvResponse {
+	cfg := entry.Env.Config()
+	return EnvResponse{
+		Id:           entry.Id,
+		CreatedAt:    entry.CreatedAt,
+		TicksPerStep: cfg.TicksPerStep,
+		MaxSteps:     cfg.MaxSteps,
+		Rewards:      GymRewards(*cfg.Rewards),
+	}
+}
+
+func newObservationResponse(obs gym.Observation) ObservationResponse {
+	return ObservationResponse{
+		Observation: obs.Vector,
+		TimeSec:     obs.Time.Seconds(),
+	}
+}
+
+func NewGymSpaceHandler(log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := GymSpaceResponse{
+			Actions:     gym.ActionNames,
+			Observation: gym.ObservationLabels,
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// body is optional, defaults are used for missing fields
+func NewCreateEnvHandler(log *slog.Logger, reg *gym.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateEnvRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode env config: %s", err.Error()))
+			return
+		}
+
+		cfg := gym.Config{
+			TicksPerStep: req.TicksPerStep,
+			MaxSteps:     req.MaxSteps,
+		}
+		if req.Rewards != nil {
+			rewards := gym.Rewards(*req.Rewards)
+			cfg.Rewards = &rewards
+		}
+
+		entry, err := reg.Create(cfg)
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(newEnvResponse(entry)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewListEnvsHandler(log *slog.Logger, reg *gym.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all := reg.List()
+
+		resp := make([]EnvResponse, 0, len(all))
+		for _, entry := range all {
+			resp = append(resp, newEnvResponse(entry))
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewDeleteEnvHandler(log *slog.Logger, reg *gym.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		envId := r.PathValue(envPathName)
+
+		if err := reg.Delete(envId); err != nil {
+			writeError(w, log, err, map[string]any{"envId": envId})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// body is optional, seed is zero by default
+func NewResetEnvHandler(log *slog.Logger, reg *gym.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		envId := r.PathValue(envPathName)
+
+		entry, err := reg.Get(envId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"envId": envId})
+			return
+		}
+
+		var req ResetEnvRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode reset request: %s", err.Error()))
+			return
+		}
+
+		obs := entry.Env.Reset(req.Seed)
+
+		if err := json.NewEncoder(w).Encode(newObservationResponse(obs)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewStepEnvHandler(log *slog.Logger, reg *gym.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		envId := r.PathValue(envPathName)
+
+		entry, err := reg.Get(envId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"envId": envId})
+			return
+		}
+
+		var req StepEnvRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode step request: %s", err.Error()))
+			return
+		}
+
+		var action gym.Action
+		switch {
+		case req.ActionName != "":
+			action, err = gym.ParseAction(req.ActionName)
+			if err != nil {
+				writeError(w, log, err, map[string]any{"action": req.ActionName})
+				return
+			}
+		case req.Action != nil:
+			action = gym.Action(*req.Action)
+		default:
+			writeBadRequest(w, log, "missing action field")
+			return
+		}
+
+		res, err := entry.Env.Step(r.Context(), action)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"envId": envId, "action": action.String()})
+			return
+		}
+
+		resp := StepEnvResponse{
+			ObservationResponse: newObservationResponse(res.Observation),
+			Reward:              res.Reward,
+			Done:                res.Done,
+			Truncated:           res.Truncated,
+			Error:               res.Error,
+			Sorted:              res.Sorted,
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewObserveEnvHandler(log *slog.Logger, reg *gym.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		envId := r.PathValue(envPathName)
+
+		entry, err := reg.Get(envId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"envId": envId})
+			return
+		}
+
+		obs, err := entry.Env.Observe()
+		if err != nil {
+			writeError(w, log, err, map[string]any{"envId": envId})
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(newObservationResponse(obs)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+type HistoryResponse struct {
+	Enabled bool       `json:"enabled"`
+	Origin  *time.Time `json:"origin,omitempty"` // relative ?at= times are counted from it
+	Start   *time.Time `json:"start,omitempty"`
+	End     *time.Time `json:"end,omitempty"`
+}
+
+// range of time past line states can be requested for
+func NewHistoryHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rng, err := s.GetHistoryRange()
+
+		resp := HistoryResponse{Enabled: !errors.Is(err, core.ErrHistoryDisabled)}
+		if err == nil {
+			resp.Origin = &rng.Origin
+			resp.Start = &rng.Start
+			resp.End = &rng.End
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// time is rfc3339 or offset from history origin like 12.35 (seconds) or 1m5s
+func parseHistoryTime(s *core.Service, param string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, param); err == nil {
+		return t, nil
+	}
+
+	offset, err := time.ParseDuration(param)
+	if err != nil {
+		sec, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return time.Time{}, errors.New("at should be rfc3339 time, seconds or duration from history origin")
+		}
+		offset = time.Duration(sec * float64(time.Second))
+	}
+
+	rng, err := s.GetHistoryRange()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return rng.Origin.Add(offset), nil
+}
@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+	"github.com/Razzle131/line316/tp_model/lines"
+)
+
+const linePathName = "line_id"
+
+type CreateLineRequest struct {
+	State *core.Snapshot `json:"state"`
+	Seed  *int64         `json:"seed"`
+}
+
+type LineResponse struct {
+	Id        string    `json:"id"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastUsed  time.Time `json:"lastUsed"`
+}
+
+func newLineResponse(line *lines.Line) LineResponse {
+	return LineResponse{
+		Id:        line.Id,
+		Path:      fmt.Sprintf("/lines/%s", line.Id),
+		CreatedAt: line.CreatedAt,
+		LastUsed:  line.LastUsed(),
+	}
+}
+
+// body is optional, line starts from default state
+func NewCreateLineHandler(log *slog.Logger, reg *lines.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateLineRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode line config: %s", err.Error()))
+			return
+		}
+
+		line, err := reg.Create(lines.LineConfig{
+			InitialState: req.State,
+			Seed:         req.Seed,
+		})
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(newLineResponse(line)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewListLinesHandler(log *slog.Logger, reg *lines.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all := reg.List()
+
+		resp := make([]LineResponse, 0, len(all))
+		for _, line := range all {
+			resp = append(resp, newLineResponse(line))
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewDeleteLineHandler(log *slog.Logger, reg *lines.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lineId := r.PathValue(linePathName)
+
+		err := reg.Delete(lineId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"lineId": lineId})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// forwards /lines/{line_id}/... to line handler
+func NewLineHandler(log *slog.Logger, reg *lines.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lineId := r.PathValue(linePathName)
+
+		line, err := reg.Get(lineId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"lineId": lineId})
+			return
+		}
+
+		http.StripPrefix(fmt.Sprintf("/lines/%s", lineId), line).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,185 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+const codeOk = "ok"
+
+type commandKey struct {
+	endpoint string
+	code     string
+}
+
+// counts handled commands by endpoint and error code
+type CommandMetrics struct {
+	mu     sync.Mutex
+	counts map[commandKey]int
+}
+
+func NewCommandMetrics() *CommandMetrics {
+	return &CommandMetrics{
+		counts: make(map[commandKey]int),
+	}
+}
+
+func (m *CommandMetrics) add(endpoint, code string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[commandKey{endpoint, code}]++
+}
+
+// returns counts sorted by endpoint and code
+func (m *CommandMetrics) list() ([]commandKey, []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]commandKey, 0, len(m.counts))
+	for k := range m.counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	values := make([]int, len(keys))
+	for i, k := range keys {
+		values[i] = m.counts[k]
+	}
+
+	return keys, values
+}
+
+// remembers error code written by handler
+type codeRecorder struct {
+	http.ResponseWriter
+	code string
+}
+
+func (r *codeRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func CountCommands(m *CommandMetrics, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &codeRecorder{ResponseWriter: w, code: codeOk}
+		next.ServeHTTP(rec, r)
+		m.add(r.Pattern, rec.code)
+	}
+}
+
+func NewMetricsHandler(s *core.Service, commands *CommandMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := s.GetStatistics()
+		alarms := s.GetAlarms()
+
+		var m metricsWriter
+
+		m.header("line316_pucks_produced_total", "counter", "Pucks sorted, by color.")
+		colors := make([]string, 0, len(stats.Produced))
+		for color := range stats.Produced {
+			colors = append(colors, color)
+		}
+		sort.Strings(colors)
+		for _, color := range colors {
+			m.sample("line316_pucks_produced_total", float64(stats.Produced[color]), "color", color)
+		}
+
+		m.header("line316_pucks_created_total", "counter", "Pucks placed on start.")
+		m.sample("line316_pucks_created_total", float64(stats.PucksCreated))
+
+		m.header("line316_pucks_lost_total", "counter", "Pucks removed from line by reset or state restore.")
+		m.sample("line316_pucks_lost_total", float64(stats.PucksLost))
+
+		m.header("line316_pucks_scrapped_total", "counter", "Sorted pucks which are not good output, by reason.")
+		for _, reason := range []string{core.ScrapWrongVariant, core.ScrapBinOverflow} {
+			m.sample("line316_pucks_scrapped_total", float64(stats.PucksScrapped[reason]), "reason", reason)
+		}
+
+		m.header("line316_commands_total", "counter", "Handled commands, by endpoint and error code.")
+		keys, values := commands.list()
+		for i, k := range keys {
+			m.sample("line316_commands_total", float64(values[i]), "endpoint", k.endpoint, "code", k.code)
+		}
+
+		m.header("line316_gripper_travel_meters_total", "counter", "Distance travelled by gripper, by axis.")
+		m.sample("line316_gripper_travel_meters_total", stats.GripperHorizontalTravel, "axis", "horizontal")
+		m.sample("line316_gripper_travel_meters_total", stats.GripperVerticalTravel, "axis", "vertical")
+
+		m.header("line316_carousel_rotations_total", "counter", "Carousel rotations by one slot.")
+		m.sample("line316_carousel_rotations_total", float64(stats.CarouselRotations))
+
+		m.header("line316_station_busy_seconds_total", "counter", "Time spent working, by station.")
+		for _, station := range []string{core.StationGripper, core.StationCarousel, core.StationPackaging, core.StationSorting} {
+			m.sample("line316_station_busy_seconds_total", stats.BusyTime[station].Seconds(), "station", station)
+		}
+
+		active := make(map[string]int)
+		unacknowledged := make(map[string]int)
+		for _, a := range alarms {
+			if a.IsActive {
+				active[a.Severity]++
+			}
+			if !a.IsAcknowledged {
+				unacknowledged[a.Severity]++
+			}
+		}
+		severities := []string{core.AlarmSeverityWarning, core.AlarmSeverityError, core.AlarmSeverityCritical}
+
+		m.header("line316_alarms_active", "gauge", "Alarms with present condition, by severity.")
+		for _, severity := range severities {
+			m.sample("line316_alarms_active", float64(active[severity]), "severity", severity)
+		}
+
+		m.header("line316_alarms_unacknowledged", "gauge", "Alarms not acknowledged by operator, by severity.")
+		for _, severity := range severities {
+			m.sample("line316_alarms_unacknowledged", float64(unacknowledged[severity]), "severity", severity)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(m.b.String()))
+	}
+}
+
+// prometheus text exposition format
+type metricsWriter struct {
+	b strings.Builder
+}
+
+func (m *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(&m.b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(&m.b, "# TYPE %s %s\n", name, kind)
+}
+
+// labels are name, value pairs
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.b.WriteString(name)
+	if len(labels) > 0 {
+		m.b.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.b.WriteString(",")
+			}
+			fmt.Fprintf(&m.b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		m.b.WriteString("}")
+	}
+	fmt.Fprintf(&m.b, " %g\n", value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+type MotionProfile struct {
+	Acceleration float64 `json:"acceleration"` // m/s², full speed at once if zero
+	Deceleration float64 `json:"deceleration"` // m/s², stops at once if zero
+	GripperMass  float64 `json:"gripperMass"`  // kg
+	PuckMass     float64 `json:"puckMass"`     // kg
+	Pneumatic    bool    `json:"pneumatic"`    // vertical axis runs between end positions only
+	StrokeTimeMs int64   `json:"strokeTimeMs"` // of empty pneumatic cylinder
+}
+
+func NewMotionProfileHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := s.GetMotionProfile()
+
+		resp := MotionProfile{
+			Acceleration: p.Acceleration,
+			Deceleration: p.Deceleration,
+			GripperMass:  p.GripperMass,
+			PuckMass:     p.PuckMass,
+			Pneumatic:    p.Pneumatic,
+			StrokeTimeMs: p.StrokeTime.Milliseconds(),
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// replaces gripper kinematics, gripper should stand still
+func NewSetMotionProfileHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req MotionProfile
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode motion profile: %s", err.Error()))
+			return
+		}
+
+		p := core.MotionProfile{
+			Acceleration: req.Acceleration,
+			Deceleration: req.Deceleration,
+			GripperMass:  req.GripperMass,
+			PuckMass:     req.PuckMass,
+			Pneumatic:    req.Pneumatic,
+			StrokeTime:   time.Duration(req.StrokeTimeMs) * time.Millisecond,
+		}
+		if err := s.SetMotionProfile(p); err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
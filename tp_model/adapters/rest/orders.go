@@ -0,0 +1,156 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+const orderPathName = "order_id"
+
+type OrderItem struct {
+	Color     string `json:"color"`
+	IsDrilled bool   `json:"isDrilled"`
+	Quantity  int    `json:"quantity"`
+	Fulfilled int    `json:"fulfilled"`
+}
+
+type Order struct {
+	Id           int         `json:"id"`
+	Status       string      `json:"status"`
+	Items        []OrderItem `json:"items"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	CompletedAt  *time.Time  `json:"completedAt"`
+	Overproduced int         `json:"overproduced"`
+	WrongVariant int         `json:"wrongVariant"`
+}
+
+type CreateOrderRequest struct {
+	Items []OrderItem `json:"items"`
+}
+
+func NewCreateOrderHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode order: %s", err.Error()))
+			return
+		}
+
+		items := make([]core.OrderItem, 0, len(req.Items))
+		for _, item := range req.Items {
+			items = append(items, core.OrderItem{
+				Color:     item.Color,
+				IsDrilled: item.IsDrilled,
+				Quantity:  item.Quantity,
+			})
+		}
+
+		order, err := s.CreateOrder(items)
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(orderToResponse(order)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewOrdersHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orders := s.GetOrders()
+
+		resp := make([]Order, 0, len(orders))
+		for _, order := range orders {
+			resp = append(resp, orderToResponse(order))
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewOrderHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderId, err := strconv.Atoi(r.PathValue(orderPathName))
+		if err != nil {
+			writeBadRequest(w, log, "order id should be integer")
+			return
+		}
+
+		order, err := s.GetOrder(orderId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"orderId": orderId})
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(orderToResponse(order)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// returns order controller should produce now
+func NewNextOrderHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		order, err := s.GetActiveOrder()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(orderToResponse(order)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewCancelOrderHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orderId, err := strconv.Atoi(r.PathValue(orderPathName))
+		if err != nil {
+			writeBadRequest(w, log, "order id should be integer")
+			return
+		}
+
+		err = s.CancelOrder(orderId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"orderId": orderId})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func orderToResponse(order core.Order) Order {
+	resp := Order{
+		Id:           order.Id,
+		Status:       order.Status,
+		Items:        make([]OrderItem, 0, len(order.Items)),
+		CreatedAt:    order.CreatedAt,
+		CompletedAt:  order.CompletedAt,
+		Overproduced: order.Overproduced,
+		WrongVariant: order.WrongVariant,
+	}
+
+	for _, item := range order.Items {
+		resp.Items = append(resp.Items, OrderItem{
+			Color:     item.Color,
+			IsDrilled: item.IsDrilled,
+			Quantity:  item.Quantity,
+			Fulfilled: item.Fulfilled,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/Razzle131/line316/tp_model/auto"
+	"github.com/Razzle131/line316/tp_model/core"
+	"github.com/Razzle131/line316/tp_model/planner"
+)
+
+type PuckGoal struct {
+	Id       int    `json:"id"`
+	From     string `json:"from"`
+	Slot     int    `json:"slot"`
+	Location string `json:"location"`
+	Drilled  *bool  `json:"drilled"`
+	Packaged *bool  `json:"packaged"`
+}
+
+// state is optional, current line state is used if missing
+type PlanRequest struct {
+	State *core.Snapshot `json:"state"`
+	Pucks []PuckGoal     `json:"pucks"`
+}
+
+type PlanStep struct {
+	Command string `json:"command"`
+	Station string `json:"station,omitempty"`
+}
+
+type PlanResponse struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+func newPlanResponse(steps []planner.Step) PlanResponse {
+	resp := PlanResponse{
+		Steps: make([]PlanStep, 0, len(steps)),
+	}
+	for _, step := range steps {
+		resp.Steps = append(resp.Steps, PlanStep(step))
+	}
+	return resp
+}
+
+// returns command sequence reaching goal without executing it
+func NewPlanHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		steps, ok := plan(w, r, log, s, true)
+		if !ok {
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(newPlanResponse(steps)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// plans from current line state and executes plan by built-in controller, progress is in auto status
+func NewPlanExecuteHandler(log *slog.Logger, s *core.Service, c *auto.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		steps, ok := plan(w, r, log, s, false)
+		if !ok {
+			return
+		}
+
+		if err := c.StartPlan(steps); err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(newPlanResponse(steps)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func plan(w http.ResponseWriter, r *http.Request, log *slog.Logger, s *core.Service, allowState bool) ([]planner.Step, bool) {
+	var req PlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeBadRequest(w, log, fmt.Sprintf("cannot decode plan request: %s", err.Error()))
+		return nil, false
+	}
+
+	snap := s.Snapshot()
+	if req.State != nil {
+		if !allowState {
+			writeBadRequest(w, log, "plan is executed from current line state, state field is not allowed")
+			return nil, false
+		}
+		snap = *req.State
+	}
+
+	goal := planner.Goal{
+		Pucks: make([]planner.PuckGoal, 0, len(req.Pucks)),
+	}
+	for _, g := range req.Pucks {
+		goal.Pucks = append(goal.Pucks, planner.PuckGoal(g))
+	}
+
+	steps, err := planner.Plan(snap, goal)
+	if err != nil {
+		writeError(w, log, err, nil)
+		return nil, false
+	}
+
+	return steps, true
+}
@@ -0,0 +1,85 @@
+package rest
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/plc"
+)
+
+const controllerPathName = "controller_name"
+
+type PLCStatusResponse struct {
+	Running    bool       `json:"running"`
+	Controller string     `json:"controller,omitempty"`
+	Cycles     uint64     `json:"cycles"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	Errors     int        `json:"errors"`
+	LastError  string     `json:"lastError,omitempty"`
+}
+
+func NewPLCStatusHandler(log *slog.Logger, rt *plc.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := rt.Status()
+
+		resp := PLCStatusResponse{
+			Running:    status.Running,
+			Controller: status.Controller,
+			Cycles:     status.Cycles,
+			StartedAt:  status.StartedAt,
+			Errors:     status.Errors,
+		}
+		if status.LastError != nil {
+			resp.LastError = status.LastError.Error()
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewPLCControllersHandler(log *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(plc.Names()); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// starts controller compiled into binary
+func NewPLCStartHandler(log *slog.Logger, rt *plc.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue(controllerPathName)
+		if name == "" {
+			writeBadRequest(w, log, "missing controller name field")
+			return
+		}
+
+		ctrl, err := plc.New(name)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"controller": name})
+			return
+		}
+
+		if err := rt.Start(name, ctrl); err != nil {
+			writeError(w, log, err, map[string]any{"controller": name})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewPLCStopHandler(log *slog.Logger, rt *plc.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := rt.Stop(); err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
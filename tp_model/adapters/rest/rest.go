@@ -2,9 +2,13 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Razzle131/line316/tp_model/core"
@@ -20,7 +24,7 @@ func NewStartPuck(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := s.PlaceNewStartPuck()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -38,13 +42,13 @@ func NewSensorHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		sensorId := r.PathValue(sensorPathName)
 		if sensorId == "" {
-			http.Error(w, "missing sensor id field", http.StatusBadRequest)
+			writeBadRequest(w, log, "missing sensor id field")
 			return
 		}
 
 		val, err := s.GetSensorValue(sensorId)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, map[string]any{"sensorId": sensorId})
 			return
 		}
 
@@ -54,11 +58,391 @@ func NewSensorHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	}
 }
 
+const actuatorPathName = "actuator_id"
+
+type GetActuatorResponse struct {
+	Value bool `json:"value"`
+}
+
+func NewActuatorHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actuatorId := r.PathValue(actuatorPathName)
+		if actuatorId == "" {
+			writeBadRequest(w, log, "missing actuator id field")
+			return
+		}
+
+		val, err := s.GetActuatorValue(actuatorId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"actuatorId": actuatorId})
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(GetActuatorResponse{val}); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewActuatorActivateHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return newActuatorWriteHandler(log, s, true)
+}
+
+func NewActuatorDeactivateHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return newActuatorWriteHandler(log, s, false)
+}
+
+func newActuatorWriteHandler(log *slog.Logger, s *core.Service, value bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actuatorId := r.PathValue(actuatorPathName)
+		if actuatorId == "" {
+			writeBadRequest(w, log, "missing actuator id field")
+			return
+		}
+
+		err := s.SetActuatorValue(actuatorId, value)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"actuatorId": actuatorId})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewEventsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var since uint64
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			since, err = strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				writeBadRequest(w, log, "bad since param")
+				return
+			}
+		}
+
+		if err := json.NewEncoder(w).Encode(s.GetEvents(since)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewEventsStreamHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, log, errors.New("streaming is not supported"), nil)
+			return
+		}
+
+		events, unsubscribe := s.SubscribeEvents()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					log.Error("cannot encode event", "error", err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Kind, data)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+type Alarm struct {
+	Id             string     `json:"id"`
+	Severity       string     `json:"severity"`
+	Source         string     `json:"source"`
+	Message        string     `json:"message"`
+	RaisedAt       time.Time  `json:"raisedAt"`
+	ClearedAt      *time.Time `json:"clearedAt"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+	IsActive       bool       `json:"isActive"`
+	IsAcknowledged bool       `json:"isAcknowledged"`
+}
+
+func NewAlarmsHandler(s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alarms := s.GetAlarms()
+
+		resp := make([]Alarm, 0, len(alarms))
+		for _, a := range alarms {
+			resp = append(resp, Alarm{
+				Id:             a.Id,
+				Severity:       a.Severity,
+				Source:         a.Source,
+				Message:        a.Message,
+				RaisedAt:       a.RaisedAt,
+				ClearedAt:      a.ClearedAt,
+				AcknowledgedAt: a.AcknowledgedAt,
+				IsActive:       a.IsActive,
+				IsAcknowledged: a.IsAcknowledged,
+			})
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+const alarmPathName = "alarm_id"
+
+func NewAlarmAcknowledgeHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alarmId := r.PathValue(alarmPathName)
+		if alarmId == "" {
+			writeBadRequest(w, log, "missing alarm id field")
+			return
+		}
+
+		err := s.AcknowledgeAlarm(alarmId)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"alarmId": alarmId})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewAlarmAcknowledgeAllHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.AcknowledgeAllAlarms()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+const defaultWaitTimeout = 5 * time.Second
+
+type WaitResponse struct {
+	SatisfiedAt time.Time `json:"satisfiedAt"`
+	WaitedMs    int64     `json:"waitedMs"`
+}
+
+// conditions from query params are combined with AND:
+// sensor=<id>&value=<bool>, gripper=idle, carousel=stopped, slot=<n>&occupied=<bool>,
+// encoder=<id>&min=<counts>&max=<counts>
+func NewWaitHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		conds := make([]core.Condition, 0)
+
+		if sensorId := query.Get("sensor"); sensorId != "" {
+			value, err := parseBoolParam(query.Get("value"), true)
+			if err != nil {
+				writeBadRequest(w, log, "bad value param")
+				return
+			}
+
+			cond, err := core.SensorCondition(s, sensorId, value)
+			if err != nil {
+				writeError(w, log, err, map[string]any{"sensorId": sensorId})
+				return
+			}
+			conds = append(conds, cond)
+		}
+
+		switch query.Get("gripper") {
+		case "":
+		case "idle":
+			conds = append(conds, core.GripperIdleCondition())
+		default:
+			writeBadRequest(w, log, "bad gripper param, only idle is supported")
+			return
+		}
+
+		switch query.Get("carousel") {
+		case "":
+		case "stopped":
+			conds = append(conds, core.CarouselStoppedCondition())
+		default:
+			writeBadRequest(w, log, "bad carousel param, only stopped is supported")
+			return
+		}
+
+		if v := query.Get("slot"); v != "" {
+			slot, err := strconv.Atoi(v)
+			if err != nil {
+				writeBadRequest(w, log, "bad slot param")
+				return
+			}
+
+			occupied, err := parseBoolParam(query.Get("occupied"), true)
+			if err != nil {
+				writeBadRequest(w, log, "bad occupied param")
+				return
+			}
+
+			cond, err := core.CarouselSlotCondition(slot, occupied)
+			if err != nil {
+				writeError(w, log, err, map[string]any{"slot": slot})
+				return
+			}
+			conds = append(conds, cond)
+		}
+
+		if encoderId := query.Get("encoder"); encoderId != "" {
+			lo, err := parseIntParam(query.Get("min"), math.MinInt64)
+			if err != nil {
+				writeBadRequest(w, log, "bad min param")
+				return
+			}
+
+			hi, err := parseIntParam(query.Get("max"), math.MaxInt64)
+			if err != nil {
+				writeBadRequest(w, log, "bad max param")
+				return
+			}
+
+			cond, err := core.EncoderCondition(s, encoderId, lo, hi)
+			if err != nil {
+				writeError(w, log, err, map[string]any{"encoderId": encoderId})
+				return
+			}
+			conds = append(conds, cond)
+		}
+
+		if len(conds) == 0 {
+			writeBadRequest(w, log, "no condition provided")
+			return
+		}
+
+		timeout := defaultWaitTimeout
+		if v := query.Get("timeout"); v != "" {
+			var err error
+			timeout, err = time.ParseDuration(v)
+			if err != nil {
+				writeBadRequest(w, log, "bad timeout param")
+				return
+			}
+		}
+
+		start := s.Now()
+		satisfiedAt, err := s.WaitFor(r.Context(), timeout, conds...)
+		if err != nil {
+			writeError(w, log, err, map[string]any{"timeout": timeout.String()})
+			return
+		}
+
+		resp := WaitResponse{
+			SatisfiedAt: satisfiedAt,
+			WaitedMs:    satisfiedAt.Sub(start).Milliseconds(),
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func parseBoolParam(v string, defaultValue bool) (bool, error) {
+	if v == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+func parseIntParam(v string, defaultValue int64) (int64, error) {
+	if v == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// current line state or past one with ?at=time, see parseHistoryTime
+func NewGetStateHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snap := s.Snapshot()
+		if param := r.URL.Query().Get("at"); param != "" {
+			at, err := parseHistoryTime(s, param)
+			if errors.Is(err, core.ErrHistoryDisabled) || errors.Is(err, core.ErrStateNotRecorded) {
+				writeError(w, log, err, nil)
+				return
+			}
+			if err != nil {
+				writeBadRequest(w, log, err.Error())
+				return
+			}
+
+			snap, err = s.StateAt(at)
+			if err != nil {
+				writeError(w, log, err, map[string]any{"at": at})
+				return
+			}
+		}
+
+		if err := json.NewEncoder(w).Encode(snap); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewPutStateHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var snap core.Snapshot
+		if err := json.NewDecoder(r.Body).Decode(&snap); err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode state: %s", err.Error()))
+			return
+		}
+
+		err := s.Restore(snap)
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+type ResetRequest struct {
+	KeepStatistics bool   `json:"keepStatistics"`
+	KeepFaults     bool   `json:"keepFaults"`
+	KeepOrders     bool   `json:"keepOrders"`
+	KeepDebug      bool   `json:"keepDebug"`
+	Seed           *int64 `json:"seed"`
+}
+
+// body is optional, by default everything is cleared
+func NewResetHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req ResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode reset options: %s", err.Error()))
+			return
+		}
+
+		s.Reset(core.ResetOptions{
+			KeepStatistics: req.KeepStatistics,
+			KeepFaults:     req.KeepFaults,
+			KeepOrders:     req.KeepOrders,
+			KeepDebug:      req.KeepDebug,
+			Seed:           req.Seed,
+		})
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func NewGripperLeftHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := s.MoveGripperLeft()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -70,7 +454,7 @@ func NewGripperRightHandler(log *slog.Logger, s *core.Service) http.HandlerFunc
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := s.MoveGripperRight()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -82,7 +466,7 @@ func NewGripperUpHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := s.MoveGripperUp()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -94,7 +478,7 @@ func NewGripperDownHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := s.MoveGripperDown()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -107,7 +491,7 @@ func NewGripperOpenHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 		err := s.OpenGripper()
 		if err != nil {
 			log.Error("open gripper", "error", err)
-			http.Error(w, fmt.Sprintf("suspicious opening of gripper: %s", err.Error()), http.StatusInternalServerError)
+			writeError(w, log, fmt.Errorf("suspicious opening of gripper: %w", err), nil)
 			return
 		}
 
@@ -120,7 +504,7 @@ func NewGripperCloseHandler(log *slog.Logger, s *core.Service) http.HandlerFunc
 		err := s.CloseGripper()
 		if err != nil {
 			log.Error("close gripper", "error", err)
-			http.Error(w, fmt.Sprintf("suspicious closing of gripper: %s", err.Error()), http.StatusInternalServerError)
+			writeError(w, log, fmt.Errorf("suspicious closing of gripper: %w", err), nil)
 			return
 		}
 
@@ -131,7 +515,7 @@ func NewGripperCloseHandler(log *slog.Logger, s *core.Service) http.HandlerFunc
 func NewGripperStopHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.StopGripper()
-		time.Sleep(20 * time.Millisecond)
+		s.Sleep(r.Context(), 20*time.Millisecond) // simulation time, stop takes effect only on running clock
 		s.EnableMovingGripper()
 		w.WriteHeader(http.StatusOK)
 	}
@@ -139,7 +523,11 @@ func NewGripperStopHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 
 func NewCarouselRotateHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		s.RotateCarousel()
+		err := s.RotateCarousel(r.Context())
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
 
 		w.WriteHeader(http.StatusOK)
 	}
@@ -153,7 +541,7 @@ func NewCarouselInspectHandler(log *slog.Logger, s *core.Service) http.HandlerFu
 	return func(w http.ResponseWriter, r *http.Request) {
 		puck, err := s.InspectPuck()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -167,7 +555,7 @@ func NewCarouselDrillHandler(log *slog.Logger, s *core.Service) http.HandlerFunc
 	return func(w http.ResponseWriter, r *http.Request) {
 		err := s.DrillPuck()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -177,9 +565,9 @@ func NewCarouselDrillHandler(log *slog.Logger, s *core.Service) http.HandlerFunc
 
 func NewPackagingHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := s.PackagePuck()
+		err := s.PackagePuck(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -189,9 +577,9 @@ func NewPackagingHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 
 func NewSortingHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := s.SortPuck()
+		err := s.SortPuck(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, log, err, nil)
 			return
 		}
 
@@ -199,6 +587,14 @@ func NewSortingHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
 	}
 }
 
+func NewSortingEmptyBinsHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.EmptySortingBins()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 // data for visualisation
 type Start struct {
 	PuckSlot *core.Puck `json:"puckSlot"`
@@ -219,13 +615,20 @@ type SortingLine struct {
 	PuckSlot *core.Puck             `json:"puckSlot"`
 	Produced map[string][]core.Puck `json:"produced"`
 }
+type Lights struct {
+	Green       bool `json:"green"`
+	Yellow      bool `json:"yellow"`
+	Red         bool `json:"red"`
+	StartButton bool `json:"startButton"`
+	ResetButton bool `json:"resetButton"`
+}
 
 func NewStartHandler(s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		model := s.Start
+		snap := s.Snapshot()
 
 		resp := Start{
-			PuckSlot: model.PuckSlot,
+			PuckSlot: visPuck(snap.Start.Puck),
 		}
 
 		json.NewEncoder(w).Encode(resp)
@@ -234,13 +637,13 @@ func NewStartHandler(s *core.Service) http.HandlerFunc {
 
 func NewGripperHandler(s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		model := &s.Gripper
+		snap := s.Snapshot()
 
 		resp := Gripper{
-			IsOpen:                model.IsOpen,
-			PuckSlot:              model.PuckSlot,
-			CurHorizontalPosition: model.CurHorizontalPosition,
-			CurVerticalPosition:   model.CurVerticalPosition,
+			IsOpen:                snap.Gripper.IsOpen,
+			PuckSlot:              visPuck(snap.Gripper.Puck),
+			CurHorizontalPosition: snap.Gripper.HorizontalPosition,
+			CurVerticalPosition:   snap.Gripper.VerticalPosition,
 		}
 
 		json.NewEncoder(w).Encode(resp)
@@ -249,10 +652,13 @@ func NewGripperHandler(s *core.Service) http.HandlerFunc {
 
 func NewCarouselHandler(s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		model := s.Carousel
+		snap := s.Snapshot()
 
 		resp := Carousel{
-			Slots: model.Slots,
+			Slots: make([]*core.Puck, len(snap.Carousel.Slots)),
+		}
+		for i, puck := range snap.Carousel.Slots {
+			resp.Slots[i] = visPuck(puck)
 		}
 
 		json.NewEncoder(w).Encode(resp)
@@ -261,10 +667,10 @@ func NewCarouselHandler(s *core.Service) http.HandlerFunc {
 
 func NewPackagingLineHandler(s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		model := s.PackagingLine
+		snap := s.Snapshot()
 
 		resp := PackagingLine{
-			PuckSlot: model.PuckSlot,
+			PuckSlot: visPuck(snap.Packaging.Puck),
 		}
 
 		json.NewEncoder(w).Encode(resp)
@@ -273,11 +679,46 @@ func NewPackagingLineHandler(s *core.Service) http.HandlerFunc {
 
 func NewSortingLineHandler(s *core.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		model := s.SortingLine
+		snap := s.Snapshot()
 
 		resp := SortingLine{
-			PuckSlot: model.PuckSlot,
-			Produced: model.Produced,
+			PuckSlot: visPuck(snap.Sorting.Puck),
+			Produced: make(map[string][]core.Puck, len(snap.Sorting.Produced)),
+		}
+		for color, pucks := range snap.Sorting.Produced {
+			for _, puck := range pucks {
+				resp.Produced[color] = append(resp.Produced[color], *visPuck(&puck))
+			}
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// visualisation shows pucks as they are in the model, state is read through snapshot so it is consistent
+func visPuck(puck *core.PuckState) *core.Puck {
+	if puck == nil {
+		return nil
+	}
+
+	return &core.Puck{
+		Id:         puck.Id,
+		Color:      puck.Color,
+		IsDrilled:  puck.IsDrilled,
+		IsPackaged: puck.IsPackaged,
+	}
+}
+
+func NewLightsHandler(s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		model := s.GetLights()
+
+		resp := Lights{
+			Green:       model.Green,
+			Yellow:      model.Yellow,
+			Red:         model.Red,
+			StartButton: model.StartButton,
+			ResetButton: model.ResetButton,
 		}
 
 		json.NewEncoder(w).Encode(resp)
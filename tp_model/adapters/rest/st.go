@@ -0,0 +1,169 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/plc"
+	"github.com/Razzle131/line316/tp_model/st"
+)
+
+const maxProgramSize = 1 << 20
+
+type STProgramResponse struct {
+	Name    string   `json:"name"`
+	Source  string   `json:"source"`
+	Inputs  []string `json:"inputs"`  // bound sensor ids
+	Outputs []string `json:"outputs"` // bound output and actuator ids
+}
+
+type STVariable struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Binding string `json:"binding,omitempty"`
+	Value   any    `json:"value"` // times are in go duration format, function blocks are objects of fields
+}
+
+type STVariablesResponse struct {
+	Program   string       `json:"program"`
+	Running   bool         `json:"running"`
+	Fault     string       `json:"fault,omitempty"`
+	Variables []STVariable `json:"variables"`
+}
+
+// compiles structured text program from request body, program replaces previous one when plc is stopped
+func NewSTUploadHandler(log *slog.Logger, store *st.Store, rt *plc.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		src, err := io.ReadAll(io.LimitReader(r.Body, maxProgramSize+1))
+		if err != nil {
+			writeBadRequest(w, log, fmt.Sprintf("cannot read program: %s", err.Error()))
+			return
+		}
+		if len(src) > maxProgramSize {
+			writeBadRequest(w, log, "program is too large")
+			return
+		}
+
+		prog, err := st.Compile(string(src))
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		if rt.Status().Running {
+			writeError(w, log, plc.ErrAlreadyRunning, nil)
+			return
+		}
+		store.Set(prog)
+
+		if err := json.NewEncoder(w).Encode(newSTProgramResponse(prog)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+func NewSTProgramHandler(log *slog.Logger, store *st.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prog, err := store.Get()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(newSTProgramResponse(prog)); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// live values of program variables
+func NewSTVariablesHandler(log *slog.Logger, store *st.Store, rt *plc.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prog, err := store.Get()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		status := rt.Status()
+		resp := STVariablesResponse{
+			Program:   prog.Name(),
+			Running:   status.Running && status.Controller == st.ControllerName(prog),
+			Variables: make([]STVariable, 0),
+		}
+		if err := prog.Fault(); err != nil {
+			resp.Fault = err.Error()
+		}
+		for _, v := range prog.Variables() {
+			resp.Variables = append(resp.Variables, STVariable{
+				Name:    v.Name,
+				Type:    v.Type,
+				Binding: v.Binding,
+				Value:   stValue(v.Value),
+			})
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// starts uploaded program from initial values
+func NewSTStartHandler(log *slog.Logger, store *st.Store, rt *plc.Runtime) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prog, err := store.Get()
+		if err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		if rt.Status().Running {
+			writeError(w, log, plc.ErrAlreadyRunning, nil)
+			return
+		}
+		prog.Reset()
+
+		if err := rt.Start(st.ControllerName(prog), prog); err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func newSTProgramResponse(prog *st.Program) STProgramResponse {
+	inputs, outputs := prog.Bindings()
+	if inputs == nil {
+		inputs = make([]string, 0)
+	}
+	if outputs == nil {
+		outputs = make([]string, 0)
+	}
+
+	return STProgramResponse{
+		Name:    prog.Name(),
+		Source:  prog.Source(),
+		Inputs:  inputs,
+		Outputs: outputs,
+	}
+}
+
+func stValue(v any) any {
+	switch v := v.(type) {
+	case time.Duration:
+		return v.String()
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for name, field := range v {
+			res[name] = stValue(field)
+		}
+		return res
+	}
+	return v
+}
@@ -0,0 +1,232 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+type TraceSignal struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Analog bool   `json:"analog,omitempty"`
+	Unit   string `json:"unit,omitempty"`
+}
+
+type TraceTrigger struct {
+	Signal string `json:"signal"`         // signal id
+	Edge   string `json:"edge,omitempty"` // rising, falling or any, rising by default
+}
+
+type StartTraceRequest struct {
+	Capacity   int           `json:"capacity,omitempty"`   // samples, one per tick
+	PreTrigger int           `json:"preTrigger,omitempty"` // samples kept before trigger
+	Trigger    *TraceTrigger `json:"trigger,omitempty"`
+}
+
+type TraceStatusResponse struct {
+	State       string        `json:"state"`
+	Capacity    int           `json:"capacity,omitempty"`
+	PreTrigger  int           `json:"preTrigger,omitempty"`
+	Trigger     *TraceTrigger `json:"trigger,omitempty"`
+	Samples     int           `json:"samples"`
+	StartedAt   *time.Time    `json:"startedAt,omitempty"`
+	TriggeredAt *time.Time    `json:"triggeredAt,omitempty"`
+	Signals     []TraceSignal `json:"signals"`
+}
+
+func NewTraceStatusHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := s.GetTraceStatus()
+
+		resp := TraceStatusResponse{
+			State:       status.State,
+			Capacity:    status.Options.Capacity,
+			PreTrigger:  status.Options.PreTrigger,
+			Samples:     status.Samples,
+			StartedAt:   status.StartedAt,
+			TriggeredAt: status.TriggeredAt,
+			Signals:     make([]TraceSignal, 0),
+		}
+		if trigger := status.Options.Trigger; trigger != nil {
+			resp.Trigger = &TraceTrigger{Signal: trigger.Signal, Edge: trigger.Edge}
+		}
+		for _, signal := range s.TraceSignals() {
+			resp.Signals = append(resp.Signals, TraceSignal(signal))
+		}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Error("cannot encode reply", "error", err)
+		}
+	}
+}
+
+// starts new trace, it waits for trigger if one is given
+func NewTraceStartHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req StartTraceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeBadRequest(w, log, fmt.Sprintf("cannot decode trace request: %s", err.Error()))
+			return
+		}
+
+		opts := core.TraceOptions{
+			Capacity:   req.Capacity,
+			PreTrigger: req.PreTrigger,
+		}
+		if req.Trigger != nil {
+			opts.Trigger = &core.TraceTrigger{Signal: req.Trigger.Signal, Edge: req.Trigger.Edge}
+		}
+
+		if err := s.StartTrace(opts); err != nil {
+			writeError(w, log, err, nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewTraceStopHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.StopTrace()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// value change dump for gtkwave and other waveform viewers, time is counted from first sample
+func NewTraceVCDHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := s.GetTrace()
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Disposition", "attachment; filename=trace.vcd")
+
+		bw := bufio.NewWriter(w)
+		writeVCD(bw, data)
+		if err := bw.Flush(); err != nil {
+			log.Error("cannot write vcd", "error", err)
+		}
+	}
+}
+
+func NewTraceCSVHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := s.GetTrace()
+
+		header := []string{"time", "offset_sec"}
+		for _, signal := range data.Signals {
+			header = append(header, signal.Id)
+		}
+
+		rows := [][]string{header}
+		for _, sample := range data.Samples {
+			row := []string{
+				sample.Time.Format(time.RFC3339Nano),
+				strconv.FormatFloat(sample.Time.Sub(data.Samples[0].Time).Seconds(), 'f', 3, 64),
+			}
+			for i, value := range sample.Values {
+				if data.Signals[i].Analog {
+					row = append(row, strconv.FormatFloat(value, 'f', 4, 64))
+				} else {
+					row = append(row, strconv.FormatFloat(value, 'f', 0, 64))
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		writeCSV(w, log, "trace.csv", rows)
+	}
+}
+
+func writeVCD(w *bufio.Writer, data core.TraceData) {
+	start := time.Now()
+	if len(data.Samples) > 0 {
+		start = data.Samples[0].Time
+	}
+
+	fmt.Fprintf(w, "$date %s $end\n", start.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "$version tp_model trace $end\n")
+	if data.TriggeredAt != nil {
+		fmt.Fprintf(w, "$comment triggered at %d us $end\n", data.TriggeredAt.Sub(start).Microseconds())
+	}
+	fmt.Fprintf(w, "$timescale 1us $end\n")
+
+	// signals are grouped by kind in scopes
+	ids := make([]string, len(data.Signals))
+	fmt.Fprintf(w, "$scope module line $end\n")
+	for _, kind := range []string{core.TraceKindSensor, core.TraceKindActuator, core.TraceKindState} {
+		fmt.Fprintf(w, "$scope module %s $end\n", kind)
+		for i, signal := range data.Signals {
+			if signal.Kind != kind {
+				continue
+			}
+			ids[i] = vcdId(i)
+			if signal.Analog {
+				fmt.Fprintf(w, "$var real 64 %s %s $end\n", ids[i], vcdName(signal.Name))
+			} else {
+				fmt.Fprintf(w, "$var wire 1 %s %s $end\n", ids[i], vcdName(signal.Name))
+			}
+		}
+		fmt.Fprintf(w, "$upscope $end\n")
+	}
+	fmt.Fprintf(w, "$upscope $end\n")
+	fmt.Fprintf(w, "$enddefinitions $end\n")
+
+	var prev []float64
+	for _, sample := range data.Samples {
+		changed := make([]int, 0)
+		for i, value := range sample.Values {
+			if prev == nil || prev[i] != value {
+				changed = append(changed, i)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "#%d\n", sample.Time.Sub(start).Microseconds())
+		if prev == nil {
+			fmt.Fprintf(w, "$dumpvars\n")
+		}
+		for _, i := range changed {
+			if data.Signals[i].Analog {
+				fmt.Fprintf(w, "r%s %s\n", strconv.FormatFloat(sample.Values[i], 'g', -1, 64), ids[i])
+			} else {
+				fmt.Fprintf(w, "%d%s\n", int(sample.Values[i]), ids[i])
+			}
+		}
+		if prev == nil {
+			fmt.Fprintf(w, "$end\n")
+		}
+		prev = sample.Values
+	}
+}
+
+// short identifier of printable ascii characters
+func vcdId(i int) string {
+	id := ""
+	for {
+		id += string(rune('!' + i%94))
+		i /= 94
+		if i == 0 {
+			return id
+		}
+	}
+}
+
+// signal names should have no white space
+func vcdName(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
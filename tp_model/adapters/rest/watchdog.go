@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+// every command feeds line watchdog
+func FeedWatchdog(s *core.Service, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.FeedWatchdog()
+		next.ServeHTTP(w, r)
+	}
+}
+
+// long waits hold line watchdog, client blocked in them is not silent
+func HoldWatchdog(s *core.Service, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		release := s.HoldWatchdog()
+		defer release()
+		next.ServeHTTP(w, r)
+	}
+}
+
+type WatchdogResponse struct {
+	IsEnabled bool       `json:"isEnabled"`
+	IsArmed   bool       `json:"isArmed"`
+	TimeoutMs int64      `json:"timeoutMs"`
+	LastFeed  *time.Time `json:"lastFeed,omitempty"`
+}
+
+func NewWatchdogHandler(s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := s.GetWatchdogStatus()
+
+		resp := WatchdogResponse{
+			IsEnabled: status.Timeout > 0,
+			IsArmed:   status.IsArmed,
+			TimeoutMs: status.Timeout.Milliseconds(),
+		}
+		if !status.LastFeed.IsZero() {
+			resp.LastFeed = &status.LastFeed
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// does nothing, watchdog is fed by command middleware
+func NewWatchdogHeartbeatHandler(log *slog.Logger, s *core.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
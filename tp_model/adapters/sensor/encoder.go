@@ -0,0 +1,27 @@
+package sensor
+
+// linear encoder, value is position in counts
+type Encoder struct {
+	name  string
+	addr  string
+	value int64
+}
+
+func NewEncoder(name, addr string) *Encoder {
+	return &Encoder{
+		name: name,
+		addr: addr,
+	}
+}
+
+func (e *Encoder) GetName() string {
+	return e.name
+}
+
+func (e *Encoder) GetValue() int64 {
+	return e.value
+}
+
+func (e *Encoder) WriteValue(newValue int64) {
+	e.value = newValue
+}
@@ -14,6 +14,10 @@ func New(name, addr string) *Sensor {
 	}
 }
 
+func (s *Sensor) GetName() string {
+	return s.name
+}
+
 func (s *Sensor) GetValue() bool {
 	return s.value
 }
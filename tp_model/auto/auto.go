@@ -0,0 +1,571 @@
+package auto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+	"github.com/Razzle131/line316/tp_model/planner"
+)
+
+var (
+	ErrAlreadyRunning = errors.New("auto controller is running already")
+	ErrNotRunning     = errors.New("auto controller is not running")
+	ErrUnknownStep    = errors.New("unknown plan step")
+)
+
+const (
+	controlOwner = "auto"
+
+	strokeTimeout = 30 * time.Second // ideal full stroke takes 0.9s, slow motion profiles take longer
+	moveTimeout   = 10 * time.Second // longest horizontal move is less than 6s
+	stopSettle    = 20 * time.Millisecond
+	strokeTop     = 0.09 // m, vertical encoder reads upper end of stroke there, lower end is zero
+	inspectSlot   = 4    // rotations from gripper slot to inspection
+	carouselSlots = 6
+)
+
+// gripper position sensors from left to right
+var stationSensors = []string{"ns:1, i:1", "ns:1, i:2", "ns:1, i:3", "ns:1, i:4"}
+
+// gripper height, counts go from zero at lower end of stroke
+const verticalEncoder = "ns:1, i:19"
+
+const (
+	posCarousel = iota
+	posStart
+	posPackaging
+	posSorting
+)
+
+var stationPositions = map[string]int{
+	planner.StationCarousel:  posCarousel,
+	planner.StationStart:     posStart,
+	planner.StationPackaging: posPackaging,
+	planner.StationSorting:   posSorting,
+}
+
+type Status struct {
+	Running       bool
+	Step          string
+	Cycles        int
+	StartedAt     *time.Time
+	LastCycleTime time.Duration
+	LastError     error
+}
+
+// reference controller running full process in a loop,
+// it uses only commands and sensors available to clients
+type Controller struct {
+	log *slog.Logger
+	s   *core.Service
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	status Status
+
+	token string
+	pos   int // gripper station after homing
+}
+
+func New(log *slog.Logger, s *core.Service) *Controller {
+	return &Controller{
+		log: log.With("controller", controlOwner),
+		s:   s,
+	}
+}
+
+// takes line control and starts process loop
+func (c *Controller) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.status.Running {
+		return ErrAlreadyRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := c.begin(cancel); err != nil {
+		cancel()
+		return err
+	}
+
+	go func() {
+		defer cancel()
+		c.finish(c.loop(ctx, 0))
+	}()
+
+	return nil
+}
+
+// takes line control and executes plan steps one by one, controller stops after last step
+func (c *Controller) StartPlan(steps []planner.Step) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.status.Running {
+		return ErrAlreadyRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := c.begin(cancel); err != nil {
+		cancel()
+		return err
+	}
+
+	go func() {
+		defer cancel()
+		c.finish(c.execute(ctx, steps))
+	}()
+
+	return nil
+}
+
+// runs given number of cycles in caller goroutine, in fast mode caller drives the clock this way
+func (c *Controller) Run(ctx context.Context, cycles int) error {
+	c.mu.Lock()
+	if c.status.Running {
+		c.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := c.begin(cancel); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.mu.Unlock()
+
+	err := c.loop(ctx, cycles)
+	c.finish(err)
+
+	return err
+}
+
+// stops process loop and waits for it, gripper is halted
+func (c *Controller) Stop() error {
+	c.mu.Lock()
+	if !c.status.Running {
+		c.mu.Unlock()
+		return ErrNotRunning
+	}
+	cancel, done := c.cancel, c.done
+	c.mu.Unlock()
+
+	cancel()
+	<-done
+
+	return nil
+}
+
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// should be called with mu held
+func (c *Controller) begin(cancel context.CancelFunc) error {
+	lease, err := c.s.AcquireControl(controlOwner)
+	if err != nil {
+		return err
+	}
+	c.token = lease.Token
+
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	now := c.s.Now()
+	c.status = Status{
+		Running:   true,
+		StartedAt: &now,
+	}
+
+	c.log.Info("auto controller started")
+
+	return nil
+}
+
+// runs cycles until error, runs forever if cycles is zero
+func (c *Controller) loop(ctx context.Context, cycles int) error {
+	ctx, cancel := c.untilClosed(ctx)
+	defer cancel()
+
+	if err := c.home(ctx); err != nil {
+		return err
+	}
+
+	for i := 0; cycles == 0 || i < cycles; i++ {
+		start := c.s.Now()
+		if err := c.cycle(ctx); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.status.Cycles++
+		c.status.LastCycleTime = c.s.Now().Sub(start)
+		c.mu.Unlock()
+	}
+
+	return nil
+}
+
+// ctx is cancelled when line is closed
+func (c *Controller) untilClosed(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-c.s.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+func (c *Controller) finish(err error) {
+	// halted gripper does not need running clock to stop, so stop does not wait for paused line
+	c.s.HaltGripper()
+	c.s.ReleaseControl(c.token)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Running = false
+	if err != nil && !errors.Is(err, context.Canceled) {
+		c.status.LastError = err
+		c.log.Error("auto controller stopped", "step", c.status.Step, "error", err)
+	} else {
+		c.log.Info("auto controller stopped", "cycles", c.status.Cycles)
+	}
+	close(c.done)
+}
+
+// lifts gripper and moves it to carousel, the only position known without sensors
+func (c *Controller) home(ctx context.Context) error {
+	c.setStep("homing")
+
+	if err := c.vertical(ctx, c.s.MoveGripperUp, true); err != nil {
+		return err
+	}
+
+	c.pos = posSorting
+	return c.moveTo(ctx, posCarousel)
+}
+
+func (c *Controller) execute(ctx context.Context, steps []planner.Step) error {
+	ctx, cancel := c.untilClosed(ctx)
+	defer cancel()
+
+	if err := c.home(ctx); err != nil {
+		return err
+	}
+
+	for i, step := range steps {
+		c.setStep(fmt.Sprintf("plan %d/%d: %s", i+1, len(steps), step))
+		if err := c.step(ctx, step); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Controller) step(ctx context.Context, step planner.Step) error {
+	switch step.Command {
+	case planner.CmdPick, planner.CmdPlace:
+		pos, found := stationPositions[step.Station]
+		if !found {
+			return fmt.Errorf("%w: %s", ErrUnknownStep, step)
+		}
+		if err := c.moveTo(ctx, pos); err != nil {
+			return err
+		}
+		if step.Command == planner.CmdPick {
+			return c.pick(ctx)
+		}
+		return c.place(ctx)
+	case planner.CmdRotate:
+		return c.rotate(ctx, 1)
+	}
+
+	if err := c.command(ctx); err != nil {
+		return err
+	}
+
+	switch step.Command {
+	case planner.CmdDrill:
+		return c.s.DrillPuck()
+	case planner.CmdPackage:
+		return c.s.PackagePuck(ctx)
+	case planner.CmdSort:
+		return c.s.SortPuck(ctx)
+	case planner.CmdEmptyBins:
+		c.s.EmptySortingBins()
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnknownStep, step)
+}
+
+// feed, inspect, drill, package and sort one puck
+func (c *Controller) cycle(ctx context.Context) error {
+	c.setStep("feed")
+	if err := c.moveTo(ctx, posStart); err != nil {
+		return err
+	}
+	if err := c.command(ctx); err != nil {
+		return err
+	}
+	// puck left on start from previous run is fine too
+	if err := c.s.PlaceNewStartPuck(); err != nil && !errors.Is(err, core.ErrSlotOccupied) {
+		return err
+	}
+	if err := c.pick(ctx); err != nil {
+		return err
+	}
+
+	c.setStep("load carousel")
+	if err := c.moveTo(ctx, posCarousel); err != nil {
+		return err
+	}
+	if err := c.place(ctx); err != nil {
+		return err
+	}
+
+	c.setStep("inspect")
+	if err := c.rotate(ctx, inspectSlot); err != nil {
+		return err
+	}
+	puck, err := c.s.InspectPuck()
+	if err != nil {
+		return err
+	}
+
+	c.setStep("drill")
+	if err := c.rotate(ctx, 1); err != nil {
+		return err
+	}
+	if c.shouldDrill(puck.Color) {
+		if err := c.s.DrillPuck(); err != nil {
+			return err
+		}
+	}
+	if err := c.rotate(ctx, carouselSlots-inspectSlot-1); err != nil {
+		return err
+	}
+
+	c.setStep("package")
+	if err := c.pick(ctx); err != nil {
+		return err
+	}
+	if err := c.moveTo(ctx, posPackaging); err != nil {
+		return err
+	}
+	if err := c.place(ctx); err != nil {
+		return err
+	}
+	if err := c.command(ctx); err != nil {
+		return err
+	}
+	if err := c.s.PackagePuck(ctx); err != nil {
+		return err
+	}
+
+	c.setStep("sort")
+	if err := c.pick(ctx); err != nil {
+		return err
+	}
+	if err := c.moveTo(ctx, posSorting); err != nil {
+		return err
+	}
+	if err := c.place(ctx); err != nil {
+		return err
+	}
+	if err := c.command(ctx); err != nil {
+		return err
+	}
+	// operator would empty full bins
+	for _, alarm := range c.s.GetAlarms() {
+		if alarm.Id == core.AlarmBinFull && alarm.IsActive {
+			c.s.EmptySortingBins()
+		}
+	}
+	err = c.s.SortPuck(ctx)
+
+	return err
+}
+
+// drills unless active order still wants undrilled puck of that color
+func (c *Controller) shouldDrill(color string) bool {
+	order, err := c.s.GetActiveOrder()
+	if err != nil {
+		return true
+	}
+
+	wantDrilled, wantPlain := false, false
+	for _, item := range order.Items {
+		if item.Color != color || item.Fulfilled >= item.Quantity {
+			continue
+		}
+		if item.IsDrilled {
+			wantDrilled = true
+		} else {
+			wantPlain = true
+		}
+	}
+
+	return wantDrilled || !wantPlain
+}
+
+// takes puck from station under gripper, gripper ends up
+func (c *Controller) pick(ctx context.Context) error {
+	if err := c.vertical(ctx, c.s.MoveGripperDown, false); err != nil {
+		return err
+	}
+	if err := c.s.OpenGripper(); err != nil {
+		return err
+	}
+	if err := c.s.CloseGripper(); err != nil {
+		return err
+	}
+	return c.vertical(ctx, c.s.MoveGripperUp, true)
+}
+
+// places puck to station under gripper, gripper ends up and closed
+func (c *Controller) place(ctx context.Context) error {
+	if err := c.vertical(ctx, c.s.MoveGripperDown, false); err != nil {
+		return err
+	}
+	if err := c.s.OpenGripper(); err != nil {
+		return err
+	}
+	if err := c.vertical(ctx, c.s.MoveGripperUp, true); err != nil {
+		return err
+	}
+	return c.s.CloseGripper()
+}
+
+func (c *Controller) rotate(ctx context.Context, times int) error {
+	for range times {
+		if err := c.command(ctx); err != nil {
+			return err
+		}
+		if err := c.s.RotateCarousel(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// full vertical stroke, there is no end switch so controller watches vertical encoder
+func (c *Controller) vertical(ctx context.Context, move func() error, up bool) error {
+	cond, err := c.strokeEnd(up)
+	if err != nil {
+		return err
+	}
+
+	if err := c.command(ctx); err != nil {
+		return err
+	}
+	if err := move(); err != nil {
+		return err
+	}
+
+	if _, err := c.s.WaitFor(ctx, strokeTimeout, cond); err != nil {
+		return err
+	}
+
+	return c.stopGripper(ctx)
+}
+
+// encoder counts at upper or lower end of vertical stroke
+func (c *Controller) strokeEnd(up bool) (core.Condition, error) {
+	ch, err := c.s.GetEncoderCharacteristics(verticalEncoder)
+	if err != nil {
+		return nil, err
+	}
+
+	if up {
+		return core.EncoderCondition(c.s, verticalEncoder, int64(math.Round(strokeTop/ch.Resolution)), math.MaxInt64)
+	}
+	return core.EncoderCondition(c.s, verticalEncoder, math.MinInt64, 0)
+}
+
+func (c *Controller) moveTo(ctx context.Context, pos int) error {
+	if pos == c.pos {
+		return nil
+	}
+
+	if err := c.command(ctx); err != nil {
+		return err
+	}
+
+	var err error
+	if pos < c.pos {
+		err = c.s.MoveGripperLeft()
+	} else {
+		err = c.s.MoveGripperRight()
+	}
+	if err != nil {
+		return err
+	}
+
+	cond, err := core.SensorCondition(c.s, stationSensors[pos], true)
+	if err != nil {
+		return err
+	}
+	if _, err := c.s.WaitFor(ctx, moveTimeout, cond); err != nil {
+		return err
+	}
+
+	c.pos = pos
+
+	return c.stopGripper(ctx)
+}
+
+// ctx cancels only waiting, gripper is halted by finish then
+func (c *Controller) stopGripper(ctx context.Context) error {
+	c.s.StopGripper()
+	defer c.s.EnableMovingGripper()
+
+	if err := c.s.Sleep(ctx, stopSettle); err != nil {
+		return err
+	}
+	// gripper with deceleration keeps braking for a while
+	_, err := c.s.WaitFor(ctx, moveTimeout, core.GripperIdleCondition())
+	return err
+}
+
+// every command keeps lease and watchdog alive, like client commands through api do
+func (c *Controller) command(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// breakpoint may pause line meanwhile, commands on paused line are refused
+	if err := c.s.WaitResumed(ctx); err != nil {
+		return err
+	}
+
+	if _, err := c.s.HeartbeatControl(c.token); err != nil {
+		return err
+	}
+	c.s.FeedWatchdog()
+
+	return nil
+}
+
+func (c *Controller) setStep(step string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Step = step
+}
@@ -10,6 +10,59 @@ type Config struct {
 	LogLevel string        `yaml:"log_level" env:"LOG_LEVEL" env-default:"DEBUG"`
 	Address  string        `yaml:"address" env:"API_ADDRESS" env-default:"localhost:8080"`
 	Timeout  time.Duration `yaml:"timeout" env:"API_TIMEOUT" env-default:"5s"`
+
+	StateFile string `yaml:"state_file" env:"STATE_FILE"` // initial line state snapshot, optional
+
+	LineIdleTimeout time.Duration `yaml:"line_idle_timeout" env:"LINE_IDLE_TIMEOUT" env-default:"30m"`
+	MaxLines        int           `yaml:"max_lines" env:"MAX_LINES" env-default:"50"`
+
+	ControlLease time.Duration `yaml:"control_lease" env:"CONTROL_LEASE" env-default:"10s"`
+	TeacherKey   string        `yaml:"teacher_key" env:"TEACHER_KEY"` // seizing control is disabled if empty
+
+	WatchdogTimeout time.Duration `yaml:"watchdog_timeout" env:"WATCHDOG_TIMEOUT" env-default:"0s"` // disabled if zero
+
+	HistoryRetention time.Duration `yaml:"history_retention" env:"HISTORY_RETENTION" env-default:"10m"` // past line states for time travel, disabled if zero
+
+	IdealCycleTime time.Duration `yaml:"ideal_cycle_time" env:"IDEAL_CYCLE_TIME" env-default:"20s"` // of good controller, analytics performance is measured against it
+
+	Seed int64 `yaml:"seed" env:"SEED"` // line random generator seed, taken from wall clock if zero
+
+	Sensors  map[string]SensorConfig  `yaml:"sensors"`  // sensor id -> characteristics, sensors not listed are ideal
+	Encoders map[string]EncoderConfig `yaml:"encoders"` // encoder id -> characteristics
+
+	Motion MotionConfig `yaml:"motion"` // gripper kinematics, ideal if not set
+
+	MaxGymEnvs     int           `yaml:"max_gym_envs" env:"MAX_GYM_ENVS" env-default:"20"` // reinforcement learning environments
+	GymIdleTimeout time.Duration `yaml:"gym_idle_timeout" env:"GYM_IDLE_TIMEOUT" env-default:"30m"`
+
+	ExercisesDir string `yaml:"exercises_dir" env:"EXERCISES_DIR" env-default:"exercises"` // yaml exercise definitions
+}
+
+// characteristics of switching sensor, like:
+//
+//	sensors:
+//	  "ns:1, i:1": {delay: 20ms, hysteresis: 0.005, bounce: 10ms}
+type SensorConfig struct {
+	Delay      time.Duration `yaml:"delay"`
+	Hysteresis float64       `yaml:"hysteresis"` // m
+	Bounce     time.Duration `yaml:"bounce"`
+}
+
+type EncoderConfig struct {
+	Resolution float64 `yaml:"resolution"` // m per count, default if zero
+	Noise      float64 `yaml:"noise"`      // m, standard deviation
+}
+
+// gripper kinematics, like:
+//
+//	motion: {acceleration: 0.5, deceleration: 0.5, gripper_mass: 1, puck_mass: 0.2, pneumatic: true, stroke_time: 400ms}
+type MotionConfig struct {
+	Acceleration float64       `yaml:"acceleration"` // m/s², full speed at once if zero
+	Deceleration float64       `yaml:"deceleration"` // m/s², stops at once if zero
+	GripperMass  float64       `yaml:"gripper_mass"` // kg
+	PuckMass     float64       `yaml:"puck_mass"`    // kg
+	Pneumatic    bool          `yaml:"pneumatic"`    // vertical axis runs between end positions only
+	StrokeTime   time.Duration `yaml:"stroke_time"`  // of empty pneumatic cylinder
 }
 
 func MustLoad(cfgPath string) Config {
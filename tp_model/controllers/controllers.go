@@ -0,0 +1,2 @@
+// controllers compiled into binary, importing package registers them in plc
+package controllers
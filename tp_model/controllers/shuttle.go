@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"github.com/Razzle131/line316/tp_model/plc"
+)
+
+const (
+	sensorCarousel = "ns:1, i:1"
+	sensorSorting  = "ns:1, i:4"
+	towerGreen     = "ns:4, i:34"
+)
+
+func init() {
+	plc.Register("shuttle", func() plc.Controller {
+		return &Shuttle{}
+	})
+}
+
+// moves gripper between carousel and sorting end positions, example of scan cycle controller
+type Shuttle struct {
+	toLeft bool
+}
+
+func (c *Shuttle) Scan(in plc.ProcessImage) plc.Outputs {
+	if c.toLeft && in.Inputs[sensorCarousel] {
+		c.toLeft = false
+	} else if !c.toLeft && in.Inputs[sensorSorting] {
+		c.toLeft = true
+	}
+
+	return plc.Outputs{
+		towerGreen:          true,
+		plc.OutGripperLeft:  c.toLeft,
+		plc.OutGripperRight: !c.toLeft,
+	}
+}
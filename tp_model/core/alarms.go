@@ -0,0 +1,185 @@
+package core
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AlarmSeverityWarning  = "warning"
+	AlarmSeverityError    = "error"
+	AlarmSeverityCritical = "critical"
+)
+
+const (
+	AlarmGripperCollision  = "gripper_collision"
+	AlarmBinFull           = "bin_full"
+	AlarmInvariantViolated = "invariant_violation"
+	AlarmSensorStuck       = "sensor_stuck"
+	AlarmWatchdog          = "watchdog_timeout"
+)
+
+var alarmIds = []string{AlarmGripperCollision, AlarmBinFull, AlarmInvariantViolated, AlarmSensorStuck, AlarmWatchdog}
+
+// id is one of alarms line raises
+func IsAlarmId(id string) bool {
+	return slices.Contains(alarmIds, id)
+}
+
+type Alarm struct {
+	Id             string
+	Severity       string
+	Source         string
+	Message        string
+	RaisedAt       time.Time
+	ClearedAt      *time.Time
+	AcknowledgedAt *time.Time
+	IsActive       bool // condition is still present
+	IsAcknowledged bool
+}
+
+// alarm stays in the list until its condition is cleared and it is acknowledged by operator
+type AlarmManager struct {
+	mu     sync.Mutex
+	alarms map[string]*Alarm // id -> alarm
+	events *EventLog
+	clock  *Clock
+}
+
+func NewAlarmManager(events *EventLog, clock *Clock) *AlarmManager {
+	return &AlarmManager{
+		alarms: make(map[string]*Alarm),
+		events: events,
+		clock:  clock,
+	}
+}
+
+// raises alarm if condition is true, clears it otherwise
+func (m *AlarmManager) Set(id, severity, source, message string, condition bool) {
+	if condition {
+		m.Raise(id, severity, source, message)
+	} else {
+		m.Clear(id)
+	}
+}
+
+func (m *AlarmManager) Raise(id, severity, source, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alarm, found := m.alarms[id]
+	if found && alarm.IsActive {
+		return
+	}
+
+	m.alarms[id] = &Alarm{
+		Id:       id,
+		Severity: severity,
+		Source:   source,
+		Message:  message,
+		RaisedAt: m.clock.Now(),
+		IsActive: true,
+	}
+
+	m.events.Add(EventAlarmRaised, source, message, map[string]any{"id": id, "severity": severity})
+}
+
+func (m *AlarmManager) Clear(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alarm, found := m.alarms[id]
+	if !found || !alarm.IsActive {
+		return
+	}
+
+	now := m.clock.Now()
+	alarm.IsActive = false
+	alarm.ClearedAt = &now
+
+	m.events.Add(EventAlarmCleared, alarm.Source, alarm.Message, map[string]any{"id": id})
+
+	if alarm.IsAcknowledged {
+		delete(m.alarms, id)
+	}
+}
+
+func (m *AlarmManager) Acknowledge(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alarm, found := m.alarms[id]
+	if !found {
+		return ErrAlarmNotFound
+	}
+
+	m.acknowledge(alarm)
+
+	return nil
+}
+
+func (m *AlarmManager) AcknowledgeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, alarm := range m.alarms {
+		m.acknowledge(alarm)
+	}
+}
+
+func (m *AlarmManager) acknowledge(alarm *Alarm) {
+	if alarm.IsAcknowledged {
+		return
+	}
+
+	now := m.clock.Now()
+	alarm.IsAcknowledged = true
+	alarm.AcknowledgedAt = &now
+
+	m.events.Add(EventAlarmAcknowledged, alarm.Source, alarm.Message, map[string]any{"id": alarm.Id})
+
+	if !alarm.IsActive {
+		delete(m.alarms, alarm.Id)
+	}
+}
+
+// returns alarms sorted by raise time
+func (m *AlarmManager) List() []Alarm {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]Alarm, 0, len(m.alarms))
+	for _, alarm := range m.alarms {
+		res = append(res, *alarm)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].RaisedAt.Before(res[j].RaisedAt)
+	})
+
+	return res
+}
+
+// reports if there is active alarm stopping production
+func (m *AlarmManager) HasFault() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, alarm := range m.alarms {
+		if alarm.IsActive && alarm.Severity != AlarmSeverityWarning {
+			return true
+		}
+	}
+
+	return false
+}
+
+// drops all alarms without acknowledgement, used on line reset
+func (m *AlarmManager) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.alarms = make(map[string]*Alarm)
+}
@@ -0,0 +1,339 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// rough time of full cycle done by good controller: feed, drill, package and sort
+	defaultIdealCycleTime = 20 * time.Second
+)
+
+const (
+	StationStateBusy    = "busy"
+	StationStateIdle    = "idle"
+	StationStateBlocked = "blocked" // holds finished puck which can not go further
+	StationStateStarved = "starved" // has no puck to work on
+)
+
+var analyticsStations = []string{StationGripper, StationCarousel, StationPackaging, StationSorting}
+
+type PuckCycle struct {
+	PuckId    int
+	Color     string
+	CreatedAt time.Time
+	SortedAt  *time.Time
+}
+
+func (c PuckCycle) CycleTime() (time.Duration, bool) {
+	if c.SortedAt == nil {
+		return 0, false
+	}
+	return c.SortedAt.Sub(c.CreatedAt), true
+}
+
+type StationReport struct {
+	Station     string
+	StateTime   map[string]time.Duration // state -> time
+	Utilization float64                  // busy time / window
+}
+
+type AnalyticsReport struct {
+	WindowStart    time.Time
+	WindowEnd      time.Time
+	IsRunning      bool
+	Pucks          []PuckCycle
+	Stations       []StationReport
+	Sorted         int
+	Lost           int
+	Scrapped       int // sorted pucks of wrong variant or into full bin
+	AvgCycleTime   time.Duration
+	Throughput     float64 // sorted pucks per hour
+	FaultTime      time.Duration
+	IdealCycleTime time.Duration
+	Availability   float64
+	Performance    float64
+	Quality        float64
+	OEE            float64
+}
+
+// collects production data for run window, station states are sampled every tick
+type Analytics struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	windowEnd   *time.Time // window is running if nil
+	lastSample  time.Time
+	stateTime   map[string]map[string]time.Duration // station -> state -> time
+	faultTime   time.Duration
+	pucks       []*PuckCycle
+	pucksById   map[int]*PuckCycle
+	lost        int
+	scrapped    int
+	idealCycle  time.Duration
+	clock       *Clock
+}
+
+// default ideal cycle time is used if zero
+func NewAnalytics(idealCycleTime time.Duration, clock *Clock) *Analytics {
+	if idealCycleTime <= 0 {
+		idealCycleTime = defaultIdealCycleTime
+	}
+	a := &Analytics{idealCycle: idealCycleTime, clock: clock}
+	a.Start()
+	return a
+}
+
+// starts new run window, collected data is dropped
+func (a *Analytics) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	a.windowStart = now
+	a.windowEnd = nil
+	a.lastSample = now
+	a.stateTime = make(map[string]map[string]time.Duration)
+	for _, station := range analyticsStations {
+		a.stateTime[station] = make(map[string]time.Duration)
+	}
+	a.faultTime = 0
+	a.pucks = make([]*PuckCycle, 0)
+	a.pucksById = make(map[int]*PuckCycle)
+	a.lost = 0
+	a.scrapped = 0
+}
+
+func (a *Analytics) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.windowEnd != nil {
+		return
+	}
+
+	now := a.clock.Now()
+	a.windowEnd = &now
+}
+
+func (a *Analytics) PuckCreated(puck Puck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.windowEnd != nil {
+		return
+	}
+
+	cycle := &PuckCycle{
+		PuckId:    puck.Id,
+		Color:     puck.Color,
+		CreatedAt: a.clock.Now(),
+	}
+	a.pucks = append(a.pucks, cycle)
+	a.pucksById[puck.Id] = cycle
+}
+
+func (a *Analytics) PuckSorted(puck Puck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.windowEnd != nil {
+		return
+	}
+
+	cycle, found := a.pucksById[puck.Id]
+	if !found {
+		// puck was created before window or loaded from snapshot
+		return
+	}
+
+	now := a.clock.Now()
+	cycle.SortedAt = &now
+}
+
+func (a *Analytics) PucksLost(count int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.windowEnd != nil {
+		return
+	}
+
+	a.lost += count
+}
+
+// sorted puck is defective output
+func (a *Analytics) PuckScrapped(puck Puck) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.windowEnd != nil {
+		return
+	}
+
+	// only pucks counted as sorted in window
+	if cycle, found := a.pucksById[puck.Id]; found && cycle.SortedAt != nil {
+		a.scrapped++
+	}
+}
+
+// adds time since last sample to current station states
+func (a *Analytics) sample(states map[string]string, isFaulted bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.windowEnd != nil {
+		return
+	}
+
+	now := a.clock.Now()
+	dt := now.Sub(a.lastSample)
+	a.lastSample = now
+
+	for station, state := range states {
+		a.stateTime[station][state] += dt
+	}
+
+	if isFaulted {
+		a.faultTime += dt
+	}
+}
+
+func (a *Analytics) Report() AnalyticsReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	end := a.clock.Now()
+	if a.windowEnd != nil {
+		end = *a.windowEnd
+	}
+	window := end.Sub(a.windowStart)
+
+	report := AnalyticsReport{
+		WindowStart:    a.windowStart,
+		WindowEnd:      end,
+		IsRunning:      a.windowEnd == nil,
+		Pucks:          make([]PuckCycle, 0, len(a.pucks)),
+		Stations:       make([]StationReport, 0, len(analyticsStations)),
+		Lost:           a.lost,
+		Scrapped:       a.scrapped,
+		FaultTime:      a.faultTime,
+		IdealCycleTime: a.idealCycle,
+	}
+
+	var totalCycleTime time.Duration
+	for _, cycle := range a.pucks {
+		report.Pucks = append(report.Pucks, *cycle)
+		if cycleTime, ok := cycle.CycleTime(); ok {
+			report.Sorted++
+			totalCycleTime += cycleTime
+		}
+	}
+
+	for _, station := range analyticsStations {
+		stationReport := StationReport{
+			Station:   station,
+			StateTime: make(map[string]time.Duration),
+		}
+		for state, t := range a.stateTime[station] {
+			stationReport.StateTime[state] = t
+		}
+		if window > 0 {
+			stationReport.Utilization = a.stateTime[station][StationStateBusy].Seconds() / window.Seconds()
+		}
+		report.Stations = append(report.Stations, stationReport)
+	}
+
+	if report.Sorted > 0 {
+		report.AvgCycleTime = totalCycleTime / time.Duration(report.Sorted)
+	}
+
+	if window <= 0 {
+		return report
+	}
+
+	report.Throughput = float64(report.Sorted) / window.Hours()
+
+	// oee = availability * performance * quality
+	runTime := window - a.faultTime
+	report.Availability = runTime.Seconds() / window.Seconds()
+	if runTime > 0 {
+		report.Performance = min(1, a.idealCycle.Seconds()*float64(report.Sorted)/runTime.Seconds())
+	}
+	// pucks removed by reset or restore are not output, so lost ones do not count
+	if report.Sorted > 0 {
+		report.Quality = float64(report.Sorted-report.Scrapped) / float64(report.Sorted)
+	}
+	report.OEE = report.Availability * report.Performance * report.Quality
+
+	return report
+}
+
+func (s *Service) stationStates() map[string]string {
+	states := make(map[string]string, len(analyticsStations))
+	hasPucks := len(s.allPucks()) > 0
+
+	switch {
+	case s.Gripper.IsMovingHorizontaly || s.Gripper.IsMovingVerticly:
+		states[StationGripper] = StationStateBusy
+	case s.Gripper.PuckSlot != nil:
+		states[StationGripper] = StationStateBlocked
+	case !hasPucks:
+		states[StationGripper] = StationStateStarved
+	default:
+		states[StationGripper] = StationStateIdle
+	}
+
+	carouselIsEmpty := true
+	for _, puck := range s.Carousel.Slots {
+		if puck != nil {
+			carouselIsEmpty = false
+		}
+	}
+	switch {
+	case s.Carousel.IsRotating:
+		states[StationCarousel] = StationStateBusy
+	case carouselIsEmpty:
+		states[StationCarousel] = StationStateStarved
+	case s.Carousel.Slots[0] != nil:
+		states[StationCarousel] = StationStateBlocked
+	default:
+		states[StationCarousel] = StationStateIdle
+	}
+
+	switch {
+	case s.PackagingLine.IsPackaging:
+		states[StationPackaging] = StationStateBusy
+	case s.PackagingLine.PuckSlot == nil:
+		states[StationPackaging] = StationStateStarved
+	case s.PackagingLine.PuckSlot.IsPackaged:
+		states[StationPackaging] = StationStateBlocked
+	default:
+		states[StationPackaging] = StationStateIdle
+	}
+
+	switch {
+	case s.SortingLine.IsSorting:
+		states[StationSorting] = StationStateBusy
+	case s.SortingLine.PuckSlot == nil:
+		states[StationSorting] = StationStateStarved
+	case s.SortingLine.IsBinFull():
+		states[StationSorting] = StationStateBlocked
+	default:
+		states[StationSorting] = StationStateIdle
+	}
+
+	return states
+}
+
+func (s *Service) GetAnalytics() AnalyticsReport {
+	return s.analytics.Report()
+}
+
+func (s *Service) StartAnalytics() {
+	s.analytics.Start()
+}
+
+func (s *Service) StopAnalytics() {
+	s.analytics.Stop()
+}
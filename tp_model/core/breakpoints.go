@@ -0,0 +1,270 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	PauseReasonManual     = "manual"
+	PauseReasonBreakpoint = "breakpoint"
+	PauseReasonStep       = "step"
+)
+
+const maxStepTicks = 60 * tickrate
+
+type Breakpoint struct {
+	Id        int
+	Condition string
+	Hits      int
+	LastHitAt *time.Time
+}
+
+type SimulationStatus struct {
+	Paused     bool
+	PausedAt   *time.Time // simulation time
+	Reason     string
+	Breakpoint *Breakpoint // which paused simulation
+	StepTicks  int         // ticks left to run before pause when stepping
+}
+
+type breakpoint struct {
+	Breakpoint
+	expr    condExpr
+	wasTrue bool // breakpoint fires when condition becomes true, not while it holds
+}
+
+// pauses simulation clock when condition over line signals becomes true, checked every tick
+type Debugger struct {
+	mu          sync.Mutex
+	signals     []TraceSignal
+	breakpoints []*breakpoint
+	lastId      int
+	prev        []float64 // signal values of previous tick
+
+	reason    string
+	hit       *Breakpoint
+	stepTicks int
+	events    *EventLog
+	clock     *Clock
+}
+
+func NewDebugger(signals []TraceSignal, events *EventLog, clock *Clock) *Debugger {
+	return &Debugger{
+		signals:     signals,
+		breakpoints: make([]*breakpoint, 0),
+		events:      events,
+		clock:       clock,
+	}
+}
+
+func (d *Debugger) Add(condition string) (Breakpoint, error) {
+	expr, err := parseCondition(condition, d.signals)
+	if err != nil {
+		return Breakpoint{}, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lastId++
+	bp := &breakpoint{
+		Breakpoint: Breakpoint{Id: d.lastId, Condition: condition},
+		expr:       expr,
+	}
+	// condition holding already does not fire until it becomes false and true again
+	if d.prev != nil {
+		bp.wasTrue = expr(d.prev, d.prev) != 0
+	}
+	d.breakpoints = append(d.breakpoints, bp)
+
+	return bp.Breakpoint, nil
+}
+
+func (d *Debugger) List() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res := make([]Breakpoint, 0, len(d.breakpoints))
+	for _, bp := range d.breakpoints {
+		res = append(res, bp.Breakpoint)
+	}
+	return res
+}
+
+func (d *Debugger) Delete(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, bp := range d.breakpoints {
+		if bp.Id == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return ErrBreakpointNotFound
+}
+
+// deletes all breakpoints, pause state is kept
+func (d *Debugger) Clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make([]*breakpoint, 0)
+	d.prev = nil
+}
+
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.clock.IsPaused() {
+		d.stepTicks = 0
+		d.pause(PauseReasonManual, nil)
+	}
+}
+
+func (d *Debugger) Resume() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.clock.IsPaused() {
+		return ErrNotPaused
+	}
+	d.stepTicks = 0
+	d.resume()
+
+	return nil
+}
+
+// runs paused simulation for ticks and pauses it again, breakpoints still fire meanwhile
+func (d *Debugger) Step(ticks int) error {
+	if ticks < 1 || ticks > maxStepTicks {
+		return fmt.Errorf("%w: step should be from 1 to %d ticks", ErrBadStep, maxStepTicks)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.clock.IsPaused() {
+		return ErrNotPaused
+	}
+	d.stepTicks = ticks
+	d.resume()
+
+	return nil
+}
+
+func (d *Debugger) Status() SimulationStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := SimulationStatus{
+		Paused:    d.clock.IsPaused(),
+		StepTicks: d.stepTicks,
+	}
+	if status.Paused {
+		now := d.clock.Now()
+		status.PausedAt = &now
+		status.Reason = d.reason
+		status.Breakpoint = d.hit
+	}
+	return status
+}
+
+// checks breakpoints on signal values of tick
+func (d *Debugger) check(values []float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	prev := d.prev
+	if prev == nil {
+		prev = values
+	}
+	d.prev = values
+
+	var hit *breakpoint
+	for _, bp := range d.breakpoints {
+		isTrue := bp.expr(values, prev) != 0
+		if isTrue && !bp.wasTrue && hit == nil {
+			hit = bp
+		}
+		bp.wasTrue = isTrue
+	}
+
+	if d.stepTicks > 0 {
+		d.stepTicks--
+		if d.stepTicks == 0 && hit == nil {
+			d.pause(PauseReasonStep, nil)
+			return
+		}
+	}
+
+	if hit != nil {
+		now := d.clock.Now()
+		hit.Hits++
+		hit.LastHitAt = &now
+		d.stepTicks = 0
+
+		bp := hit.Breakpoint
+		d.pause(PauseReasonBreakpoint, &bp)
+	}
+}
+
+// should be called with mu held
+func (d *Debugger) pause(reason string, bp *Breakpoint) {
+	d.clock.Pause()
+	d.reason = reason
+	d.hit = bp
+
+	data := map[string]any{"reason": reason}
+	message := "simulation paused"
+	if bp != nil {
+		data["breakpoint"] = bp.Id
+		data["condition"] = bp.Condition
+		message = fmt.Sprintf("simulation paused on breakpoint %d: %s", bp.Id, bp.Condition)
+	}
+	d.events.Add(EventSimulationPaused, "debugger", message, data)
+}
+
+// should be called with mu held
+func (d *Debugger) resume() {
+	d.reason = ""
+	d.hit = nil
+	d.events.Add(EventSimulationResumed, "debugger", "simulation resumed", map[string]any{"stepTicks": d.stepTicks})
+	d.clock.Resume()
+}
+
+func (s *Service) AddBreakpoint(condition string) (Breakpoint, error) {
+	return s.debugger.Add(condition)
+}
+
+func (s *Service) GetBreakpoints() []Breakpoint {
+	return s.debugger.List()
+}
+
+func (s *Service) DeleteBreakpoint(id int) error {
+	return s.debugger.Delete(id)
+}
+
+func (s *Service) PauseSimulation() {
+	s.debugger.Pause()
+}
+
+func (s *Service) ResumeSimulation() error {
+	return s.debugger.Resume()
+}
+
+func (s *Service) StepSimulation(ticks int) error {
+	return s.debugger.Step(ticks)
+}
+
+func (s *Service) GetSimulationStatus() SimulationStatus {
+	return s.debugger.Status()
+}
+
+// blocks while simulation is paused, controllers call it before commands which are refused on paused line
+func (s *Service) WaitResumed(ctx context.Context) error {
+	return s.clock.waitResumed(ctx)
+}
@@ -0,0 +1,392 @@
+package core
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// action scheduled on clock, periodic actions repeat while fn returns true
+type Action struct {
+	at        time.Time
+	seq       uint64 // keeps order of actions scheduled on same time
+	period    time.Duration
+	fn        func() bool
+	cancelled bool
+}
+
+// source of simulation time with queue of scheduled actions.
+// real clock runs actions at wall time on its own goroutine,
+// virtual clock jumps to next action only while someone sleeps or waits on it.
+// paused clock stands still, no actions are run and sleepers wait for resume
+type Clock struct {
+	mu      sync.Mutex
+	virtual bool
+	now     time.Time // virtual time, unused by real clock
+	seq     uint64
+	queue   actionQueue
+	wake    chan struct{} // real clock runner is woken on new action
+
+	paused   bool
+	pausedAt time.Time     // clock time when paused
+	offset   time.Duration // wall time - real clock time, grows by pause durations
+	resumed  chan struct{} // closed on resume
+
+	locker sync.Locker // state lock of clock owner, actions run with it held
+}
+
+func NewRealClock() *Clock {
+	return &Clock{
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// virtual clock starting at start, nothing happens until it is advanced
+func NewVirtualClock(start time.Time) *Clock {
+	return &Clock{
+		virtual: true,
+		now:     start,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// actions are run with l held, so they do not race with code holding it
+func (c *Clock) SetLocker(l sync.Locker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.locker = l
+}
+
+func (c *Clock) IsVirtual() bool {
+	return c.virtual
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked()
+}
+
+func (c *Clock) nowLocked() time.Time {
+	switch {
+	case c.paused:
+		return c.pausedAt
+	case c.virtual:
+		return c.now
+	}
+	return time.Now().Add(-c.offset)
+}
+
+func (c *Clock) IsPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// stops clock time until resume
+func (c *Clock) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused {
+		return
+	}
+	c.pausedAt = c.nowLocked()
+	c.paused = true
+	c.resumed = make(chan struct{})
+}
+
+// clock time continues from moment of pause
+func (c *Clock) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		return
+	}
+	if !c.virtual {
+		c.offset = time.Since(c.pausedAt)
+	}
+	c.paused = false
+	close(c.resumed)
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// blocks while clock is paused
+func (c *Clock) waitResumed(ctx context.Context) error {
+	c.mu.Lock()
+	paused, resumed := c.paused, c.resumed
+	c.mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumed:
+		return nil
+	}
+}
+
+// runs fn once after d
+func (c *Clock) After(d time.Duration, fn func()) *Action {
+	return c.schedule(d, 0, func() bool {
+		fn()
+		return false
+	})
+}
+
+// runs fn every d starting after d while it returns true
+func (c *Clock) Every(d time.Duration, fn func() bool) *Action {
+	return c.schedule(d, d, fn)
+}
+
+func (c *Clock) Cancel(a *Action) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a.cancelled = true
+}
+
+func (c *Clock) schedule(d, period time.Duration, fn func() bool) *Action {
+	now := c.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	a := &Action{
+		at:     now.Add(d),
+		seq:    c.seq,
+		period: period,
+		fn:     fn,
+	}
+	heap.Push(&c.queue, a)
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+
+	return a
+}
+
+// blocks for d of clock time, virtual clock runs due actions meanwhile
+func (c *Clock) Sleep(ctx context.Context, d time.Duration) error {
+	deadline := c.Now().Add(d)
+
+	if !c.virtual {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		// clock may be paused meanwhile, so time left is checked on wake up
+		for {
+			if err := c.waitResumed(ctx); err != nil {
+				return err
+			}
+			left := deadline.Sub(c.Now())
+			if left <= 0 {
+				return nil
+			}
+			timer.Reset(left)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	for {
+		if err := c.waitResumed(ctx); err != nil {
+			return err
+		}
+		if !c.step(deadline) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	c.advanceTo(deadline)
+
+	return ctx.Err()
+}
+
+// Sleep for code holding state lock, lock is released meanwhile so actions can run
+func (c *Clock) SleepLocked(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	l := c.locker
+	c.mu.Unlock()
+
+	if l == nil {
+		return c.Sleep(ctx, d)
+	}
+
+	l.Unlock()
+	defer l.Lock()
+	return c.Sleep(ctx, d)
+}
+
+// blocks until cond holds or timeout of clock time passes, returns time when cond became true
+func (c *Clock) WaitUntil(ctx context.Context, timeout time.Duration, cond func() bool) (time.Time, error) {
+	deadline := c.Now().Add(timeout)
+
+	if !c.virtual {
+		for {
+			if cond() {
+				return c.Now(), nil
+			}
+			if !c.Now().Before(deadline) {
+				return time.Time{}, ErrWaitTimeout
+			}
+			if err := c.Sleep(ctx, time.Second/tickrate); err != nil {
+				return time.Time{}, err
+			}
+		}
+	}
+
+	// virtual state changes only in actions, so cond is checked after each
+	for {
+		if cond() {
+			return c.Now(), nil
+		}
+		if err := ctx.Err(); err != nil {
+			return time.Time{}, err
+		}
+		if err := c.waitResumed(ctx); err != nil {
+			return time.Time{}, err
+		}
+		if !c.step(deadline) {
+			c.advanceTo(deadline)
+			return time.Time{}, ErrWaitTimeout
+		}
+	}
+}
+
+// runs actions at wall time until done is closed, only for real clock
+func (c *Clock) Run(done <-chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		c.mu.Lock()
+		wait := time.Hour
+		if len(c.queue) > 0 && !c.paused {
+			wait = c.queue[0].at.Sub(c.nowLocked())
+		}
+		c.mu.Unlock()
+
+		if wait <= 0 {
+			c.step(c.Now())
+			continue
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-done:
+			return
+		case <-c.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// runs first action due not later than deadline, returns false if there is none
+func (c *Clock) step(deadline time.Time) bool {
+	c.mu.Lock()
+	if len(c.queue) == 0 || c.queue[0].at.After(deadline) || (c.paused && !c.virtual) {
+		c.mu.Unlock()
+		return false
+	}
+
+	a := heap.Pop(&c.queue).(*Action)
+	if a.cancelled {
+		c.mu.Unlock()
+		return true
+	}
+	if c.virtual && a.at.After(c.now) {
+		c.now = a.at
+	}
+	l := c.locker
+	c.mu.Unlock()
+
+	repeat := c.run(a, l)
+	if !repeat || a.period == 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// periodic action is rescheduled from its due time so it does not drift
+	if !a.cancelled {
+		c.seq++
+		a.at = a.at.Add(a.period)
+		a.seq = c.seq
+		heap.Push(&c.queue, a)
+	}
+
+	return true
+}
+
+// runs action with state lock held, action may be cancelled while waiting for the lock
+func (c *Clock) run(a *Action, l sync.Locker) bool {
+	if l == nil {
+		return a.fn()
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	c.mu.Lock()
+	cancelled := a.cancelled
+	c.mu.Unlock()
+	if cancelled {
+		return false
+	}
+
+	return a.fn()
+}
+
+func (c *Clock) advanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// actions may sleep too, virtual time never goes back
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// min heap of actions by due time and scheduling order
+type actionQueue []*Action
+
+func (q actionQueue) Len() int { return len(q) }
+
+func (q actionQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q actionQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *actionQueue) Push(x any) { *q = append(*q, x.(*Action)) }
+
+func (q *actionQueue) Pop() any {
+	old := *q
+	n := len(old)
+	a := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return a
+}
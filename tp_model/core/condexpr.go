@@ -0,0 +1,287 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// boolean expression over line signals, evaluated on current and previous tick values.
+//
+//	gripper_down and carousel_rotating
+//	rise('ns:1, i:1') && gripper_holding
+//	gripper_x > 0.3 or not 'ns:4, i:34'
+//
+// signals are trace signal ids, node ids are quoted. rise, fall and changed detect edges between ticks
+type condExpr func(cur, prev []float64) float64
+
+type condParser struct {
+	toks    []string
+	i       int
+	signals map[string]int // signal id -> index
+	analog  map[string]bool
+}
+
+func parseCondition(src string, signals []TraceSignal) (condExpr, error) {
+	toks, err := condTokens(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &condParser{
+		toks:    toks,
+		signals: make(map[string]int, len(signals)),
+		analog:  make(map[string]bool),
+	}
+	for i, signal := range signals {
+		p.signals[signal.Id] = i
+		p.analog[signal.Id] = signal.Analog
+	}
+
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.toks) {
+		return nil, p.errorf("unexpected %q", p.toks[p.i])
+	}
+
+	return e, nil
+}
+
+func (p *condParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrBreakpointInvalid, fmt.Sprintf(format, args...))
+}
+
+func (p *condParser) peek() string {
+	if p.i >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.i]
+}
+
+func (p *condParser) accept(toks ...string) bool {
+	for _, tok := range toks {
+		if strings.EqualFold(p.peek(), tok) {
+			p.i++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *condParser) or() (condExpr, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or", "||") {
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = func(x, y condExpr) condExpr {
+			return func(cur, prev []float64) float64 {
+				return condBool(x(cur, prev) != 0 || y(cur, prev) != 0)
+			}
+		}(x, y)
+	}
+	return x, nil
+}
+
+func (p *condParser) and() (condExpr, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and", "&&") {
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = func(x, y condExpr) condExpr {
+			return func(cur, prev []float64) float64 {
+				return condBool(x(cur, prev) != 0 && y(cur, prev) != 0)
+			}
+		}(x, y)
+	}
+	return x, nil
+}
+
+func (p *condParser) not() (condExpr, error) {
+	if p.accept("not", "!") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(cur, prev []float64) float64 {
+			return condBool(x(cur, prev) == 0)
+		}, nil
+	}
+	return p.comparison()
+}
+
+func (p *condParser) comparison() (condExpr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	var cmp func(a, b float64) bool
+	switch op {
+	case "<":
+		cmp = func(a, b float64) bool { return a < b }
+	case "<=":
+		cmp = func(a, b float64) bool { return a <= b }
+	case ">":
+		cmp = func(a, b float64) bool { return a > b }
+	case ">=":
+		cmp = func(a, b float64) bool { return a >= b }
+	case "==":
+		cmp = func(a, b float64) bool { return a == b }
+	case "!=":
+		cmp = func(a, b float64) bool { return a != b }
+	default:
+		return x, nil
+	}
+	p.i++
+
+	y, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	return func(cur, prev []float64) float64 {
+		return condBool(cmp(x(cur, prev), y(cur, prev)))
+	}, nil
+}
+
+func (p *condParser) primary() (condExpr, error) {
+	tok := p.peek()
+	if tok == "" {
+		return nil, p.errorf("unexpected end of condition")
+	}
+	p.i++
+
+	switch {
+	case tok == "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("expected )")
+		}
+		return e, nil
+
+	case strings.EqualFold(tok, "true"), strings.EqualFold(tok, "false"):
+		v := condBool(strings.EqualFold(tok, "true"))
+		return func(cur, prev []float64) float64 { return v }, nil
+
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '-':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, p.errorf("bad number %q", tok)
+		}
+		return func(cur, prev []float64) float64 { return v }, nil
+	}
+
+	switch strings.ToLower(tok) {
+	case "rise", "fall", "changed":
+		if !p.accept("(") {
+			return nil, p.errorf("expected ( after %s", tok)
+		}
+		i, err := p.signal(true)
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("expected ) after %s argument", tok)
+		}
+
+		switch strings.ToLower(tok) {
+		case "rise":
+			return func(cur, prev []float64) float64 { return condBool(prev[i] == 0 && cur[i] != 0) }, nil
+		case "fall":
+			return func(cur, prev []float64) float64 { return condBool(prev[i] != 0 && cur[i] == 0) }, nil
+		}
+		return func(cur, prev []float64) float64 { return condBool(prev[i] != cur[i]) }, nil
+	}
+
+	p.i--
+	i, err := p.signal(false)
+	if err != nil {
+		return nil, err
+	}
+	return func(cur, prev []float64) float64 { return cur[i] }, nil
+}
+
+func (p *condParser) signal(bitOnly bool) (int, error) {
+	tok := p.peek()
+	p.i++
+
+	id := strings.Trim(tok, `'"`)
+	i, found := p.signals[id]
+	if !found {
+		return 0, p.errorf("unknown signal %q", id)
+	}
+	if bitOnly && p.analog[id] {
+		return 0, p.errorf("edge of analog signal %q", id)
+	}
+	return i, nil
+}
+
+func condTokens(src string) ([]string, error) {
+	res := make([]string, 0)
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != c {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated quote", ErrBreakpointInvalid)
+			}
+			res = append(res, string(runes[i:end+1]))
+			i = end + 1
+
+		case unicode.IsLetter(c) || c == '_' || unicode.IsDigit(c) || c == '.' || (c == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			res = append(res, string(runes[i:end]))
+			i = end
+
+		default:
+			op := string(c)
+			if i+1 < len(runes) {
+				if two := string(runes[i : i+2]); two == "&&" || two == "||" || two == "<=" || two == ">=" || two == "==" || two == "!=" {
+					op = two
+				}
+			}
+			if !strings.Contains("()<>!&|=", op[:1]) || op == "&" || op == "|" || op == "=" {
+				return nil, fmt.Errorf("%w: unexpected %q", ErrBreakpointInvalid, op)
+			}
+			res = append(res, op)
+			i += len([]rune(op))
+		}
+	}
+
+	return res, nil
+}
+
+func condBool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -6,6 +6,8 @@ const (
 	tickrate = 100 // number of ticks in second
 )
 
+var puckColors = []string{"red", "silver", "black"}
+
 const (
 	gripperBaseLength        = 0.065 // m
 	gripperLeftSensorLength  = 0.02  // m
@@ -22,6 +24,7 @@ const (
 	gripperPackagingPos    = 0.4                                                                // m
 	gripperSortingPos      = gripperRailLength - gripperRightSensorLength - gripperBaseLength/2 // m
 	gripperAbleMiss        = 0.02                                                               // m, +- from where gripper can still operate normal, like in normal position
+	gripperSafeHeight      = gripperUpPos - gripperAbleMiss                                     // m, lower than that gripper can hit stations
 )
 
 const (
@@ -36,5 +39,18 @@ const (
 )
 
 const (
-	sortingTime = time.Millisecond * 1000
+	sortingTime        = time.Millisecond * 1000
+	sortingBinCapacity = 10 // pucks of one color
 )
+
+const (
+	sensorStuckTimeout = time.Second // sensor contradicting gripper position that long raises alarm
+)
+
+// gripper position each position sensor detects
+var positionSensors = map[string]float64{
+	"ns:1, i:1": gripperCarouselPos,
+	"ns:1, i:2": gripperStartPos,
+	"ns:1, i:3": gripperPackagingPos,
+	"ns:1, i:4": gripperSortingPos,
+}
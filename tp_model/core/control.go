@@ -0,0 +1,151 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type ControlLease struct {
+	Token     string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+// exclusive control over line commands, observers don't need it
+type ControlLock struct {
+	mu       sync.Mutex
+	lease    *ControlLease
+	duration time.Duration
+	events   *EventLog
+	clock    *Clock
+}
+
+func NewControlLock(duration time.Duration, events *EventLog, clock *Clock) *ControlLock {
+	return &ControlLock{
+		duration: duration,
+		events:   events,
+		clock:    clock,
+	}
+}
+
+func (c *ControlLock) Acquire(owner string) (ControlLease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.isHeld() {
+		return ControlLease{}, ErrControlTaken
+	}
+
+	return c.grant(owner, EventControlAcquired)
+}
+
+// takes control even if it is held by someone else
+func (c *ControlLock) Seize(owner string) (ControlLease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.grant(owner, EventControlSeized)
+}
+
+// prolongs lease of owner
+func (c *ControlLock) Heartbeat(token string) (ControlLease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isOwner(token) {
+		return ControlLease{}, ErrNotControlOwner
+	}
+
+	c.lease.ExpiresAt = c.clock.Now().Add(c.duration)
+
+	return *c.lease, nil
+}
+
+func (c *ControlLock) Release(token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isOwner(token) {
+		return ErrNotControlOwner
+	}
+
+	c.events.Add(EventControlReleased, "control", "control released", map[string]any{"owner": c.lease.Owner})
+	c.lease = nil
+
+	return nil
+}
+
+// checks that command with token is allowed, commands of owner prolong lease
+func (c *ControlLock) Check(token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isHeld() {
+		return nil
+	}
+
+	if c.lease.Token != token {
+		return ErrNotControlOwner
+	}
+
+	c.lease.ExpiresAt = c.clock.Now().Add(c.duration)
+
+	return nil
+}
+
+// returns current lease without token
+func (c *ControlLock) Current() (ControlLease, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isHeld() {
+		return ControlLease{}, false
+	}
+
+	return ControlLease{
+		Owner:     c.lease.Owner,
+		ExpiresAt: c.lease.ExpiresAt,
+	}, true
+}
+
+func (c *ControlLock) isHeld() bool {
+	if c.lease == nil {
+		return false
+	}
+
+	if c.clock.Now().After(c.lease.ExpiresAt) {
+		c.events.Add(EventControlExpired, "control", "control lease expired", map[string]any{"owner": c.lease.Owner})
+		c.lease = nil
+		return false
+	}
+
+	return true
+}
+
+func (c *ControlLock) isOwner(token string) bool {
+	return c.isHeld() && c.lease.Token == token
+}
+
+func (c *ControlLock) grant(owner string, eventKind string) (ControlLease, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ControlLease{}, err
+	}
+
+	data := map[string]any{"owner": owner}
+	if c.lease != nil {
+		data["previousOwner"] = c.lease.Owner
+	}
+
+	c.lease = &ControlLease{
+		Token:     hex.EncodeToString(b),
+		Owner:     owner,
+		ExpiresAt: c.clock.Now().Add(c.duration),
+	}
+
+	c.events.Add(eventKind, "control", "control granted", data)
+
+	return *c.lease, nil
+}
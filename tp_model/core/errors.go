@@ -5,13 +5,72 @@ import "errors"
 var (
 	ErrGripperAlreadyMoving = errors.New("gripper is moving already")
 	ErrGripperWantToStop    = errors.New("gripper is want to stop")
+	ErrGripperClosed        = errors.New("need to open gripper to take or place puck")
+	ErrGripperNotDown       = errors.New("opening gripper with puck in higher than lower position")
+	ErrNoStationAtPosition  = errors.New("no position matched for gripper")
+	ErrTakeFromSorting      = errors.New("should not take puck from sorting line")
+	ErrMotionProfileInvalid = errors.New("invalid motion profile")
 )
 
 var (
 	ErrSlotOccupied = errors.New("this slot is busy")
 	ErrSlotEmpty    = errors.New("this slot is empty")
+	ErrBadSlotParam = errors.New("bad slot param")
+
+	ErrStationAborted = errors.New("station operation aborted by reset")
+)
+
+var (
+	ErrPuckPackaged    = errors.New("puck is packaged")
+	ErrPuckNotPackaged = errors.New("need to package puck first")
+)
+
+var (
+	ErrSensorNotFound   = errors.New("sensor not found")
+	ErrActuatorNotFound = errors.New("actuator not found")
+	ErrEncoderNotFound  = errors.New("encoder not found")
+
+	ErrSensorCharacteristicsInvalid = errors.New("invalid sensor characteristics")
+)
+
+var (
+	ErrAlarmNotFound = errors.New("alarm not found")
+)
+
+var (
+	ErrWaitTimeout = errors.New("condition was not met before timeout")
+)
+
+var (
+	ErrSnapshotInvalid = errors.New("invalid state snapshot")
+	ErrLineBusy        = errors.New("line is busy")
+)
+
+var (
+	ErrControlTaken    = errors.New("line is controlled by another client")
+	ErrNotControlOwner = errors.New("client does not own line control")
+)
+
+var (
+	ErrOrderInvalid  = errors.New("invalid order")
+	ErrOrderNotFound = errors.New("order not found")
+	ErrOrderClosed   = errors.New("order is completed or cancelled")
+	ErrNoActiveOrder = errors.New("no active order")
+)
+
+var (
+	ErrTraceOptionsInvalid = errors.New("invalid trace options")
+)
+
+var (
+	ErrBreakpointInvalid  = errors.New("invalid breakpoint condition")
+	ErrBreakpointNotFound = errors.New("breakpoint not found")
+	ErrNotPaused          = errors.New("simulation is not paused")
+	ErrSimulationPaused   = errors.New("simulation is paused")
+	ErrBadStep            = errors.New("bad step")
 )
 
 var (
-	ErrPuckPackaged = errors.New("puck is packaged")
+	ErrHistoryDisabled  = errors.New("state history is disabled")
+	ErrStateNotRecorded = errors.New("state is not recorded at that time")
 )
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	eventLogSize         = 10000 // max number of events kept in memory
+	subscriberBufferSize = 100
+)
+
+const (
+	EventActuator          = "actuator"
+	EventAlarmRaised       = "alarm_raised"
+	EventAlarmCleared      = "alarm_cleared"
+	EventAlarmAcknowledged = "alarm_acknowledged"
+	EventStateRestored     = "state_restored"
+	EventReset             = "reset"
+	EventControlAcquired   = "control_acquired"
+	EventControlSeized     = "control_seized"
+	EventControlReleased   = "control_released"
+	EventControlExpired    = "control_expired"
+	EventOrderCreated      = "order_created"
+	EventOrderActivated    = "order_activated"
+	EventOrderCompleted    = "order_completed"
+	EventOrderCancelled    = "order_cancelled"
+	EventOrderOverproduced = "order_overproduced"
+	EventOrderWrongVariant = "order_wrong_variant"
+	EventTraceTriggered    = "trace_triggered"
+	EventSimulationPaused  = "simulation_paused"
+	EventSimulationResumed = "simulation_resumed"
+	EventSeeded            = "seeded"
+	EventPuckSorted        = "puck_sorted"
+)
+
+var eventKinds = []string{
+	EventActuator, EventAlarmRaised, EventAlarmCleared, EventAlarmAcknowledged, EventStateRestored, EventReset,
+	EventControlAcquired, EventControlSeized, EventControlReleased, EventControlExpired,
+	EventOrderCreated, EventOrderActivated, EventOrderCompleted, EventOrderCancelled, EventOrderOverproduced, EventOrderWrongVariant,
+	EventTraceTriggered, EventSimulationPaused, EventSimulationResumed, EventSeeded, EventPuckSorted,
+}
+
+// kind is one of events line emits
+func IsEventKind(kind string) bool {
+	return slices.Contains(eventKinds, kind)
+}
+
+type Event struct {
+	Seq     uint64         `json:"seq"`
+	Time    time.Time      `json:"time"`
+	Kind    string         `json:"kind"`
+	Source  string         `json:"source"`
+	Message string         `json:"message,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+type EventLog struct {
+	mu          sync.Mutex
+	seq         uint64
+	events      []Event
+	subscribers map[chan Event]struct{}
+	clock       *Clock
+}
+
+func NewEventLog(clock *Clock) *EventLog {
+	return &EventLog{
+		clock:       clock,
+		events:      make([]Event, 0, eventLogSize),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+func (l *EventLog) Add(kind, source, message string, data map[string]any) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e := Event{
+		Seq:     l.seq,
+		Time:    l.clock.Now(),
+		Kind:    kind,
+		Source:  source,
+		Message: message,
+		Data:    data,
+	}
+
+	if len(l.events) >= eventLogSize {
+		l.events = l.events[1:]
+	}
+	l.events = append(l.events, e)
+
+	for ch := range l.subscribers {
+		select {
+		case ch <- e:
+		default: // slow subscriber, drop event
+		}
+	}
+
+	return e
+}
+
+// returns channel with new events and func to unsubscribe
+func (l *EventLog) Subscribe() (<-chan Event, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan Event, subscriberBufferSize)
+	l.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers, ch)
+	}
+}
+
+// returns events with sequence number greater than seq
+func (l *EventLog) Since(seq uint64) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := make([]Event, 0)
+	for _, e := range l.events {
+		if e.Seq > seq {
+			res = append(res, e)
+		}
+	}
+
+	return res
+}
+
+// returns sequence number of the latest event, zero if there were none
+func (l *EventLog) LastSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+// closes all subscriber channels
+func (l *EventLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.subscribers {
+		close(ch)
+		delete(l.subscribers, ch)
+	}
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const historyKeyframeInterval = time.Second
+
+type HistoryRange struct {
+	Origin time.Time // when recording began, relative times are counted from it
+	Start  time.Time // oldest moment state can be reconstructed at
+	End    time.Time
+}
+
+// parts of line state changed on tick, unchanged parts are nil
+type historyChange struct {
+	t         time.Time
+	gripper   *GripperState
+	start     *SlotState
+	carousel  *CarouselState
+	packaging *SlotState
+	sorting   *SortingState
+	actuators map[string]bool
+	seed      *int64
+}
+
+// signature of sorting state, full state is copied only when it changes
+type sortingKey struct {
+	puck     PuckState
+	hasPuck  bool
+	produced int
+	levels   int
+}
+
+// records line state to reconstruct it at any past moment, full snapshot every second
+// and changes of state parts on ticks between them
+type History struct {
+	mu        sync.Mutex
+	retention time.Duration
+	origin    time.Time
+
+	keyframes []Snapshot
+	changes   []historyChange // after first keyframe, by time
+
+	last    Snapshot // state on previous tick
+	lastKey sortingKey
+}
+
+func NewHistory(retention time.Duration) *History {
+	return &History{retention: retention}
+}
+
+// range of recorded time
+func (h *History) Range() (HistoryRange, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.keyframes) == 0 {
+		return HistoryRange{}, ErrStateNotRecorded
+	}
+	return HistoryRange{Origin: h.origin, Start: h.keyframes[0].TakenAt, End: h.last.TakenAt}, nil
+}
+
+// line state at t from latest keyframe before it and changes after the keyframe
+func (h *History) At(t time.Time) (Snapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.keyframes) == 0 || t.Before(h.keyframes[0].TakenAt) || t.After(h.last.TakenAt) {
+		return Snapshot{}, ErrStateNotRecorded
+	}
+
+	i, _ := slices.BinarySearchFunc(h.keyframes, t, func(snap Snapshot, t time.Time) int {
+		return snap.TakenAt.Compare(t)
+	})
+	if i == len(h.keyframes) || h.keyframes[i].TakenAt.After(t) {
+		i--
+	}
+	snap := copySnapshot(h.keyframes[i])
+
+	j, _ := slices.BinarySearchFunc(h.changes, snap.TakenAt, func(c historyChange, t time.Time) int {
+		if c.t.After(t) {
+			return 1
+		}
+		return -1
+	})
+	for ; j < len(h.changes) && !h.changes[j].t.After(t); j++ {
+		c := h.changes[j]
+		if c.gripper != nil {
+			snap.Gripper = *c.gripper
+		}
+		if c.start != nil {
+			snap.Start = *c.start
+		}
+		if c.carousel != nil {
+			snap.Carousel = *c.carousel
+		}
+		if c.packaging != nil {
+			snap.Packaging = *c.packaging
+		}
+		if c.sorting != nil {
+			snap.Sorting = *c.sorting
+		}
+		if c.actuators != nil {
+			snap.Actuators = c.actuators
+		}
+		if c.seed != nil {
+			snap.Seed = *c.seed
+		}
+	}
+	snap.TakenAt = t
+
+	return snap, nil
+}
+
+// records state of line, called every tick with service mu held
+func (h *History) record(s *Service) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := s.clock.Now()
+
+	if len(h.keyframes) == 0 || now.Sub(h.keyframes[len(h.keyframes)-1].TakenAt) >= historyKeyframeInterval {
+		snap := s.snapshot()
+		if len(h.keyframes) == 0 {
+			h.origin = snap.TakenAt
+		}
+		h.keyframes = append(h.keyframes, snap)
+		h.last = snap
+		h.lastKey = s.sortingKey()
+		h.trim(now)
+		return
+	}
+
+	c := historyChange{t: now}
+	changed := false
+
+	gripper := GripperState{
+		IsOpen:             s.Gripper.IsOpen,
+		Puck:               puckToState(s.Gripper.PuckSlot),
+		HorizontalPosition: s.Gripper.CurHorizontalPosition,
+		VerticalPosition:   s.Gripper.CurVerticalPosition,
+	}
+	if !gripperStateEqual(gripper, h.last.Gripper) {
+		c.gripper = &gripper
+		h.last.Gripper = gripper
+		changed = true
+	}
+
+	start := SlotState{Puck: puckToState(s.Start.PuckSlot)}
+	if !puckStateEqual(start.Puck, h.last.Start.Puck) {
+		c.start = &start
+		h.last.Start = start
+		changed = true
+	}
+
+	packaging := SlotState{Puck: puckToState(s.PackagingLine.PuckSlot)}
+	if !puckStateEqual(packaging.Puck, h.last.Packaging.Puck) {
+		c.packaging = &packaging
+		h.last.Packaging = packaging
+		changed = true
+	}
+
+	carousel := CarouselState{Slots: make([]*PuckState, len(s.Carousel.Slots))}
+	for i, puck := range s.Carousel.Slots {
+		carousel.Slots[i] = puckToState(puck)
+	}
+	if !slices.EqualFunc(carousel.Slots, h.last.Carousel.Slots, puckStateEqual) {
+		c.carousel = &carousel
+		h.last.Carousel = carousel
+		changed = true
+	}
+
+	if key := s.sortingKey(); key != h.lastKey {
+		sorting := s.snapshot().Sorting
+		c.sorting = &sorting
+		h.last.Sorting = sorting
+		h.lastKey = key
+		changed = true
+	}
+
+	actuators := make(map[string]bool, len(s.actuators))
+	for id, actuator := range s.actuators {
+		actuators[id] = actuator.IsActivated()
+	}
+	if !maps.Equal(actuators, h.last.Actuators) {
+		c.actuators = actuators
+		h.last.Actuators = actuators
+		changed = true
+	}
+
+	if seed := s.Seed(); seed != h.last.Seed {
+		c.seed = &seed
+		h.last.Seed = seed
+		changed = true
+	}
+
+	h.last.TakenAt = now
+	if changed {
+		h.changes = append(h.changes, c)
+	}
+}
+
+// drops history older than retention
+func (h *History) trim(now time.Time) {
+	n := 0
+	for n < len(h.keyframes)-1 && now.Sub(h.keyframes[n+1].TakenAt) > h.retention {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	h.keyframes = slices.Delete(h.keyframes, 0, n)
+
+	first := h.keyframes[0].TakenAt
+	m := 0
+	for m < len(h.changes) && !h.changes[m].t.After(first) {
+		m++
+	}
+	h.changes = slices.Delete(h.changes, 0, m)
+}
+
+func (s *Service) sortingKey() sortingKey {
+	key := sortingKey{}
+	if puck := s.SortingLine.PuckSlot; puck != nil {
+		key.puck = *puckToState(puck)
+		key.hasPuck = true
+	}
+	for _, pucks := range s.SortingLine.Produced {
+		key.produced += len(pucks)
+	}
+	for _, level := range s.SortingLine.BinLevels {
+		key.levels += level
+	}
+	return key
+}
+
+func gripperStateEqual(a, b GripperState) bool {
+	return a.IsOpen == b.IsOpen && a.HorizontalPosition == b.HorizontalPosition &&
+		a.VerticalPosition == b.VerticalPosition && puckStateEqual(a.Puck, b.Puck)
+}
+
+func puckStateEqual(a, b *PuckState) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// snapshot parts may be shared with history, so they are copied before change
+func copySnapshot(snap Snapshot) Snapshot {
+	snap.Carousel.Slots = slices.Clone(snap.Carousel.Slots)
+	snap.Actuators = maps.Clone(snap.Actuators)
+	return snap
+}
+
+// range of time line state is recorded for
+func (s *Service) GetHistoryRange() (HistoryRange, error) {
+	if s.history == nil {
+		return HistoryRange{}, ErrHistoryDisabled
+	}
+	return s.history.Range()
+}
+
+// line state at past moment t
+func (s *Service) StateAt(t time.Time) (Snapshot, error) {
+	if s.history == nil {
+		return Snapshot{}, ErrHistoryDisabled
+	}
+	return s.history.At(t)
+}
@@ -1,23 +1,33 @@
 package core
 
 import (
-	"errors"
+	"context"
+	"slices"
 	"sync/atomic"
 	"time"
 )
 
 type Puck struct {
+	Id         int
 	Color      string
+	IsDrilled  bool
 	IsPackaged bool
 }
 
-func NewPuck(color string) Puck {
+func NewPuck(id int, color string) Puck {
 	return Puck{
+		Id:         id,
 		Color:      color,
+		IsDrilled:  false,
 		IsPackaged: false,
 	}
 }
 
+// color is one of colors pucks are supplied in
+func IsPuckColor(color string) bool {
+	return slices.Contains(puckColors, color)
+}
+
 type Start struct {
 	PuckSlot *Puck
 }
@@ -56,9 +66,20 @@ type Gripper struct {
 	IsWantToStopMoving    atomic.Bool
 	CurHorizontalPosition float64
 	CurVerticalPosition   float64
+	HorizontalSpeed       float64 // m/s, positive to the right
+	VerticalSpeed         float64 // m/s, positive upwards
+
+	// statistics
+	HorizontalTravel float64 // m
+	VerticalTravel   float64 // m
+	BusyTime         time.Duration
+
+	clock   *Clock
+	motion  *Action       // scheduled motion steps, nil if not moving
+	profile MotionProfile // ideal motion if zero
 }
 
-func NewGripper() Gripper {
+func NewGripper(clock *Clock) Gripper {
 	return Gripper{
 		IsOpen:                false,
 		PuckSlot:              nil,
@@ -67,6 +88,7 @@ func NewGripper() Gripper {
 		IsWantToStopMoving:    atomic.Bool{},
 		CurHorizontalPosition: gripperStartPos,
 		CurVerticalPosition:   gripperUpPos,
+		clock:                 clock,
 	}
 }
 
@@ -97,7 +119,7 @@ func (g *Gripper) TakePuck(puck Puck) error {
 	}
 
 	if !g.IsOpen {
-		return errors.New("need to open gripper to take puck")
+		return ErrGripperClosed
 	}
 
 	g.PuckSlot = &puck
@@ -115,7 +137,7 @@ func (g *Gripper) PlacePuck() (Puck, error) {
 	}
 
 	if !g.IsOpen {
-		return Puck{}, errors.New("need to open gripper to place puck")
+		return Puck{}, ErrGripperClosed
 	}
 
 	puck := *g.PuckSlot
@@ -125,56 +147,33 @@ func (g *Gripper) PlacePuck() (Puck, error) {
 }
 
 func (g *Gripper) MoveLeft() error {
-	if g.IsMovingHorizontaly || g.IsMovingVerticly {
-		return ErrGripperAlreadyMoving
-	}
-
-	if g.IsWantToStopMoving.Load() {
-		return ErrGripperWantToStop
-	}
-
-	g.IsMovingHorizontaly = true
-
-	go func() {
-		ticker := time.NewTicker(time.Second / tickrate)
-		for range ticker.C {
-			if g.IsWantToStopMoving.Load() {
-				break
-			}
-			g.CurHorizontalPosition = max(gripperCarouselPos, g.CurHorizontalPosition-float64(gripperHorizontalSpeed)/tickrate)
-		}
-		g.IsMovingHorizontaly = false
-	}()
-
-	return nil
+	return g.move(&g.IsMovingHorizontaly, g.drive(&g.CurHorizontalPosition, &g.HorizontalSpeed, &g.HorizontalTravel,
+		-gripperHorizontalSpeed, gripperCarouselPos, gripperSortingPos))
 }
 
 func (g *Gripper) MoveRight() error {
-	if g.IsMovingHorizontaly || g.IsMovingVerticly {
-		return ErrGripperAlreadyMoving
-	}
+	return g.move(&g.IsMovingHorizontaly, g.drive(&g.CurHorizontalPosition, &g.HorizontalSpeed, &g.HorizontalTravel,
+		gripperHorizontalSpeed, gripperCarouselPos, gripperSortingPos))
+}
 
-	if g.IsWantToStopMoving.Load() {
-		return ErrGripperWantToStop
+func (g *Gripper) MoveUp() error {
+	if g.profile.Pneumatic {
+		return g.move(&g.IsMovingVerticly, g.stroke(1))
 	}
+	return g.move(&g.IsMovingVerticly, g.drive(&g.CurVerticalPosition, &g.VerticalSpeed, &g.VerticalTravel,
+		gripperVerticalSpeed, gripperDownPos, gripperUpPos))
+}
 
-	g.IsMovingHorizontaly = true
-
-	go func() {
-		ticker := time.NewTicker(time.Second / tickrate)
-		for range ticker.C {
-			if g.IsWantToStopMoving.Load() {
-				break
-			}
-			g.CurHorizontalPosition = min(gripperSortingPos, g.CurHorizontalPosition+float64(gripperHorizontalSpeed)/tickrate)
-		}
-		g.IsMovingHorizontaly = false
-	}()
-
-	return nil
+func (g *Gripper) MoveDown() error {
+	if g.profile.Pneumatic {
+		return g.move(&g.IsMovingVerticly, g.stroke(-1))
+	}
+	return g.move(&g.IsMovingVerticly, g.drive(&g.CurVerticalPosition, &g.VerticalSpeed, &g.VerticalTravel,
+		-gripperVerticalSpeed, gripperDownPos, gripperUpPos))
 }
 
-func (g *Gripper) MoveUp() error {
+// does step every tick until it reports motion is over, step brakes once stop is requested
+func (g *Gripper) move(isMoving *bool, step func(stopping bool) bool) error {
 	if g.IsMovingHorizontaly || g.IsMovingVerticly {
 		return ErrGripperAlreadyMoving
 	}
@@ -183,54 +182,55 @@ func (g *Gripper) MoveUp() error {
 		return ErrGripperWantToStop
 	}
 
-	g.IsMovingVerticly = true
+	*isMoving = true
 
-	go func() {
-		ticker := time.NewTicker(time.Second / tickrate)
-		for range ticker.C {
-			if g.IsWantToStopMoving.Load() {
-				break
-			}
-			g.CurVerticalPosition = min(gripperUpPos, g.CurVerticalPosition+float64(gripperVerticalSpeed)/tickrate)
+	// stop request is latched, gripper keeps braking after moving is enabled again
+	stopping := false
+	g.motion = g.clock.Every(time.Second/tickrate, func() bool {
+		if g.IsWantToStopMoving.Load() {
+			stopping = true
 		}
-		g.IsMovingVerticly = false
-	}()
+		if step(stopping) {
+			*isMoving = false
+			g.motion = nil
+			return false
+		}
+		g.BusyTime += time.Second / tickrate
+		return true
+	})
 
 	return nil
 }
 
-func (g *Gripper) MoveDown() error {
-	if g.IsMovingHorizontaly || g.IsMovingVerticly {
-		return ErrGripperAlreadyMoving
+// stops motion at once without waiting for next tick
+func (g *Gripper) Halt() {
+	if g.motion != nil {
+		g.clock.Cancel(g.motion)
+		g.motion = nil
 	}
 
-	if g.IsWantToStopMoving.Load() {
-		return ErrGripperWantToStop
-	}
-
-	g.IsMovingVerticly = true
-
-	go func() {
-		ticker := time.NewTicker(time.Second / tickrate)
-		for range ticker.C {
-			if g.IsWantToStopMoving.Load() {
-				break
-			}
-			g.CurVerticalPosition = max(gripperDownPos, g.CurVerticalPosition-float64(gripperVerticalSpeed)/tickrate)
-		}
-		g.IsMovingVerticly = false
-	}()
-
-	return nil
+	g.IsMovingHorizontaly = false
+	g.IsMovingVerticly = false
+	g.HorizontalSpeed = 0
+	g.VerticalSpeed = 0
+	g.IsWantToStopMoving.Store(false)
 }
 
 type Carousel struct {
-	Slots []*Puck
+	Slots      []*Puck
+	IsRotating bool
+
+	// statistics
+	Rotations int
+	BusyTime  time.Duration
+
+	clock *Clock
 }
 
-func NewCarousel() Carousel {
+func NewCarousel(clock *Clock) Carousel {
 	return Carousel{
 		Slots: make([]*Puck, carouselTotalSlots),
+		clock: clock,
 	}
 }
 
@@ -260,7 +260,7 @@ func (c *Carousel) TakePuck() (Puck, error) {
 
 func (c *Carousel) InspectPuck() (Puck, error) {
 	if carouselInspectSlot >= len(c.Slots) {
-		return Puck{}, errors.New("bad inspect slot param")
+		return Puck{}, ErrBadSlotParam
 	}
 
 	if c.Slots[carouselInspectSlot] == nil {
@@ -272,39 +272,53 @@ func (c *Carousel) InspectPuck() (Puck, error) {
 
 func (c *Carousel) DrillPuck() error {
 	if carouselDrillSlot >= len(c.Slots) {
-		return errors.New("bad inspect slot param")
+		return ErrBadSlotParam
 	}
 
 	if c.Slots[carouselDrillSlot] == nil {
 		return ErrSlotEmpty
 	}
 
+	c.Slots[carouselDrillSlot].IsDrilled = true
+
 	return nil
 }
 
-func (c *Carousel) RotateOnce() {
-	start := time.Now()
-	end := start.Add(carouselNextSlotTime)
+// carousel stays where it was if ctx is done before rotation ends
+func (c *Carousel) RotateOnce(ctx context.Context) error {
+	c.IsRotating = true
+	defer func() { c.IsRotating = false }()
 
 	res := make([]*Puck, len(c.Slots))
 	for i := range c.Slots {
 		res[(i+1)%len(c.Slots)] = c.Slots[i]
 	}
 
-	for time.Since(end) < 0 {
-		time.Sleep(time.Millisecond)
+	if err := c.clock.SleepLocked(ctx, carouselNextSlotTime); err != nil {
+		return err
 	}
 
 	c.Slots = res
+	c.Rotations++
+	c.BusyTime += carouselNextSlotTime
+
+	return nil
 }
 
 type PackagingLine struct {
-	PuckSlot *Puck
+	PuckSlot    *Puck
+	IsPackaging bool
+
+	// statistics
+	BusyTime time.Duration
+
+	clock *Clock
 }
 
-func NewPackagingLine() PackagingLine {
+func NewPackagingLine(clock *Clock) PackagingLine {
 	return PackagingLine{
 		PuckSlot: nil,
+		clock:    clock,
 	}
 }
 
@@ -328,7 +342,7 @@ func (p *PackagingLine) TakePuck() (Puck, error) {
 	}
 
 	if !p.PuckSlot.IsPackaged {
-		return Puck{}, errors.New("need to package puck before taking")
+		return Puck{}, ErrPuckNotPackaged
 	}
 
 	puck := *p.PuckSlot
@@ -337,7 +351,7 @@ func (p *PackagingLine) TakePuck() (Puck, error) {
 	return puck, nil
 }
 
-func (p *PackagingLine) PackagePuck() error {
+func (p *PackagingLine) PackagePuck(ctx context.Context) error {
 	if p.PuckSlot == nil {
 		return ErrSlotEmpty
 	}
@@ -346,22 +360,38 @@ func (p *PackagingLine) PackagePuck() error {
 		return ErrPuckPackaged
 	}
 
-	time.Sleep(packagingTime)
+	p.IsPackaging = true
+	defer func() { p.IsPackaging = false }()
+
+	if err := p.clock.SleepLocked(ctx, packagingTime); err != nil {
+		return err
+	}
 
 	p.PuckSlot.IsPackaged = true
+	p.BusyTime += packagingTime
 
 	return nil
 }
 
 type SortingLine struct {
-	PuckSlot *Puck
-	Produced map[string][]Puck // color -> pucks
+	PuckSlot  *Puck
+	Produced  map[string][]Puck // color -> pucks
+	BinLevels map[string]int    // color -> pucks in bin now
+	IsSorting bool
+
+	// statistics
+	BusyTime   time.Duration
+	Overflowed int // pucks sorted into full bin
+
+	clock *Clock
 }
 
-func NewSortingLine() SortingLine {
+func NewSortingLine(clock *Clock) SortingLine {
 	return SortingLine{
-		PuckSlot: nil,
-		Produced: make(map[string][]Puck),
+		PuckSlot:  nil,
+		Produced:  make(map[string][]Puck),
+		BinLevels: make(map[string]int),
+		clock:     clock,
 	}
 }
 
@@ -371,7 +401,7 @@ func (s *SortingLine) PlacePuck(puck Puck) error {
 	}
 
 	if !puck.IsPackaged {
-		return errors.New("need to package puck before placing")
+		return ErrPuckNotPackaged
 	}
 
 	s.PuckSlot = &puck
@@ -390,15 +420,48 @@ func (s *SortingLine) TakePuck() (Puck, error) {
 	return puck, nil
 }
 
-func (s *SortingLine) SortPuck() error {
+func (s *SortingLine) SortPuck(ctx context.Context) error {
 	if s.PuckSlot == nil {
 		return ErrSlotEmpty
 	}
 
-	time.Sleep(sortingTime)
+	s.IsSorting = true
+	defer func() { s.IsSorting = false }()
+
+	if err := s.clock.SleepLocked(ctx, sortingTime); err != nil {
+		return err
+	}
 
 	s.Produced[s.PuckSlot.Color] = append(s.Produced[s.PuckSlot.Color], *s.PuckSlot)
+	// puck sorted into full bin falls past it, bin_full alarm asks operator to empty bins
+	if s.BinLevels[s.PuckSlot.Color] >= sortingBinCapacity {
+		s.Overflowed++
+	}
+	s.BinLevels[s.PuckSlot.Color] = min(s.BinLevels[s.PuckSlot.Color]+1, sortingBinCapacity)
+	s.BusyTime += sortingTime
 	s.PuckSlot = nil
 
 	return nil
 }
+
+func (s *SortingLine) IsBinFull() bool {
+	for _, level := range s.BinLevels {
+		if level >= sortingBinCapacity {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SortingLine) EmptyBins() {
+	s.BinLevels = make(map[string]int)
+}
+
+// signal tower and operator panel lamps, driven by actuators
+type Lights struct {
+	Green       bool
+	Yellow      bool
+	Red         bool
+	StartButton bool
+	ResetButton bool
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	maxMotionAcceleration = 100 // m/s²
+	maxMotionMass         = 100 // kg
+	maxStrokeTime         = 10 * time.Second
+)
+
+// kinematics of gripper, zero profile moves gripper at full speed at once and stops it on next tick
+type MotionProfile struct {
+	Acceleration float64 // m/s², gripper gets full speed at once if zero
+	Deceleration float64 // m/s², gripper stops at once if zero, else it overshoots where stop was requested
+	GripperMass  float64 // kg, moving mass of empty gripper, puck mass has no effect if zero
+	PuckMass     float64 // kg, carried puck slows acceleration, braking and strokes in proportion of masses
+
+	Pneumatic  bool          // vertical axis is cylinder which runs between end positions only
+	StrokeTime time.Duration // cylinder stroke of empty gripper
+}
+
+// how many times gripper is heavier than empty one
+func (g *Gripper) load() float64 {
+	if g.PuckSlot == nil || g.profile.GripperMass == 0 {
+		return 1
+	}
+	return (g.profile.GripperMass + g.profile.PuckMass) / g.profile.GripperMass
+}
+
+// step of motor driven axis toward full speed, it brakes once stopping and is over when stopped.
+// axis end stops halt gripper at once
+func (g *Gripper) drive(pos, speed, travel *float64, fullSpeed, lo, hi float64) func(stopping bool) bool {
+	return func(stopping bool) bool {
+		accel := g.profile.Acceleration / g.load()
+		decel := g.profile.Deceleration / g.load()
+
+		switch {
+		case stopping && (decel == 0 || *speed == 0):
+			*speed = 0
+			return true
+		case stopping:
+			*speed = approach(*speed, 0, decel/tickrate)
+		case accel == 0:
+			*speed = fullSpeed
+		default:
+			*speed = approach(*speed, fullSpeed, accel/tickrate)
+		}
+
+		prevPos := *pos
+		*pos = min(hi, max(lo, *pos+*speed/tickrate))
+		*travel += math.Abs(*pos - prevPos)
+		if (*pos == lo && *speed < 0) || (*pos == hi && *speed > 0) {
+			*speed = 0
+		}
+
+		return stopping && *speed == 0
+	}
+}
+
+// step of pneumatic cylinder toward end position in dir, stop requests do not stop it
+func (g *Gripper) stroke(dir float64) func(stopping bool) bool {
+	return func(bool) bool {
+		strokeTime := g.profile.StrokeTime.Seconds() * g.load()
+		g.VerticalSpeed = dir * (gripperUpPos - gripperDownPos) / strokeTime
+
+		prevPos := g.CurVerticalPosition
+		g.CurVerticalPosition = min(gripperUpPos, max(gripperDownPos, g.CurVerticalPosition+g.VerticalSpeed/tickrate))
+		g.VerticalTravel += math.Abs(g.CurVerticalPosition - prevPos)
+
+		if g.CurVerticalPosition == gripperUpPos || g.CurVerticalPosition == gripperDownPos {
+			g.VerticalSpeed = 0
+			return true
+		}
+		return false
+	}
+}
+
+// moves v toward target by at most step
+func approach(v, target, step float64) float64 {
+	if v < target {
+		return min(target, v+step)
+	}
+	return max(target, v-step)
+}
+
+func validateMotionProfile(p MotionProfile) error {
+	if p.Acceleration < 0 || p.Acceleration > maxMotionAcceleration || p.Deceleration < 0 || p.Deceleration > maxMotionAcceleration {
+		return fmt.Errorf("%w: acceleration and deceleration should be from 0 to %d m/s²", ErrMotionProfileInvalid, maxMotionAcceleration)
+	}
+	if p.GripperMass < 0 || p.GripperMass > maxMotionMass || p.PuckMass < 0 || p.PuckMass > maxMotionMass {
+		return fmt.Errorf("%w: masses should be from 0 to %d kg", ErrMotionProfileInvalid, maxMotionMass)
+	}
+	if p.Pneumatic && (p.StrokeTime <= 0 || p.StrokeTime > maxStrokeTime) {
+		return fmt.Errorf("%w: stroke time of cylinder should be above 0 and up to %s", ErrMotionProfileInvalid, maxStrokeTime)
+	}
+	return nil
+}
+
+func (s *Service) GetMotionProfile() MotionProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Gripper.profile
+}
+
+// gripper should stand still while its profile is changed
+func (s *Service) SetMotionProfile(p MotionProfile) error {
+	if err := validateMotionProfile(p); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Gripper.IsMovingHorizontaly || s.Gripper.IsMovingVerticly {
+		return ErrGripperAlreadyMoving
+	}
+	s.Gripper.profile = p
+
+	return nil
+}
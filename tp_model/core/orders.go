@@ -0,0 +1,277 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	OrderStatusQueued    = "queued"
+	OrderStatusActive    = "active" // head of the queue, sorted pucks are counted to it
+	OrderStatusCompleted = "completed"
+	OrderStatusCancelled = "cancelled"
+)
+
+// wanted puck variant, sorted pucks are always packaged
+type OrderItem struct {
+	Color     string
+	IsDrilled bool
+	Quantity  int
+	Fulfilled int
+}
+
+type Order struct {
+	Id           int
+	Items        []OrderItem
+	Status       string
+	CreatedAt    time.Time
+	CompletedAt  *time.Time
+	Overproduced int // pucks of ordered variant sorted after item was fulfilled
+	WrongVariant int // pucks of variant not present in order
+}
+
+func (o *Order) isFulfilled() bool {
+	for _, item := range o.Items {
+		if item.Fulfilled < item.Quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// production orders processed one by one in creation order
+type OrderBook struct {
+	mu     sync.Mutex
+	lastId int
+	orders []*Order
+	events *EventLog
+	clock  *Clock
+}
+
+func NewOrderBook(events *EventLog, clock *Clock) *OrderBook {
+	return &OrderBook{
+		orders: make([]*Order, 0),
+		events: events,
+		clock:  clock,
+	}
+}
+
+func (b *OrderBook) Create(items []OrderItem) (Order, error) {
+	if len(items) == 0 {
+		return Order{}, fmt.Errorf("%w: no items", ErrOrderInvalid)
+	}
+
+	for _, item := range items {
+		if !slices.Contains(puckColors, item.Color) {
+			return Order{}, fmt.Errorf("%w: unknown puck color %q", ErrOrderInvalid, item.Color)
+		}
+		if item.Quantity <= 0 {
+			return Order{}, fmt.Errorf("%w: quantity should be positive", ErrOrderInvalid)
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastId++
+	order := &Order{
+		Id:        b.lastId,
+		Items:     make([]OrderItem, len(items)),
+		Status:    OrderStatusQueued,
+		CreatedAt: b.clock.Now(),
+	}
+	for i, item := range items {
+		order.Items[i] = OrderItem{
+			Color:     item.Color,
+			IsDrilled: item.IsDrilled,
+			Quantity:  item.Quantity,
+		}
+	}
+	b.orders = append(b.orders, order)
+
+	b.events.Add(EventOrderCreated, "orders", "order created", map[string]any{"orderId": order.Id})
+	b.activateNext()
+
+	return *order, nil
+}
+
+func (b *OrderBook) Cancel(id int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	order := b.find(id)
+	if order == nil {
+		return ErrOrderNotFound
+	}
+
+	if order.Status == OrderStatusCompleted || order.Status == OrderStatusCancelled {
+		return ErrOrderClosed
+	}
+
+	order.Status = OrderStatusCancelled
+	b.events.Add(EventOrderCancelled, "orders", "order cancelled", map[string]any{"orderId": id})
+	b.activateNext()
+
+	return nil
+}
+
+// drops all orders, ids stay unique
+func (b *OrderBook) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.orders = make([]*Order, 0)
+}
+
+func (b *OrderBook) Get(id int) (Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	order := b.find(id)
+	if order == nil {
+		return Order{}, ErrOrderNotFound
+	}
+
+	return copyOrder(order), nil
+}
+
+func (b *OrderBook) List() []Order {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := make([]Order, 0, len(b.orders))
+	for _, order := range b.orders {
+		res = append(res, copyOrder(order))
+	}
+
+	return res
+}
+
+// returns order which controller should work on now
+func (b *OrderBook) Active() (Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	order := b.active()
+	if order == nil {
+		return Order{}, ErrNoActiveOrder
+	}
+
+	return copyOrder(order), nil
+}
+
+// counts sorted puck to active order, reports if active order does not want puck of that variant
+func (b *OrderBook) PuckSorted(puck Puck) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	order := b.active()
+	if order == nil {
+		return false
+	}
+
+	// active order is never fulfilled, it is completed by the last puck
+	matched, counted := false, false
+	for i := range order.Items {
+		item := &order.Items[i]
+		if item.Color != puck.Color || item.IsDrilled != puck.IsDrilled {
+			continue
+		}
+
+		matched = true
+		if item.Fulfilled < item.Quantity {
+			item.Fulfilled++
+			counted = true
+			break
+		}
+	}
+
+	data := map[string]any{"orderId": order.Id, "puckId": puck.Id, "color": puck.Color, "isDrilled": puck.IsDrilled}
+	switch {
+	case !matched:
+		order.WrongVariant++
+		b.events.Add(EventOrderWrongVariant, "orders", "sorted puck is not in active order", data)
+		return true
+	case !counted:
+		order.Overproduced++
+		b.events.Add(EventOrderOverproduced, "orders", "sorted puck exceeds ordered quantity", data)
+		return false
+	}
+
+	if order.isFulfilled() {
+		now := b.clock.Now()
+		order.Status = OrderStatusCompleted
+		order.CompletedAt = &now
+		b.events.Add(EventOrderCompleted, "orders", "order completed", map[string]any{"orderId": order.Id})
+		b.activateNext()
+	}
+
+	return false
+}
+
+func (b *OrderBook) active() *Order {
+	for _, order := range b.orders {
+		if order.Status == OrderStatusActive {
+			return order
+		}
+	}
+	return nil
+}
+
+func (b *OrderBook) activateNext() {
+	if b.active() != nil {
+		return
+	}
+
+	for _, order := range b.orders {
+		if order.Status == OrderStatusQueued {
+			order.Status = OrderStatusActive
+			b.events.Add(EventOrderActivated, "orders", "order activated", map[string]any{"orderId": order.Id})
+			return
+		}
+	}
+}
+
+func (b *OrderBook) find(id int) *Order {
+	for _, order := range b.orders {
+		if order.Id == id {
+			return order
+		}
+	}
+	return nil
+}
+
+func copyOrder(order *Order) Order {
+	res := *order
+	res.Items = slices.Clone(order.Items)
+	return res
+}
+
+func (s *Service) CreateOrder(items []OrderItem) (Order, error) {
+	order, err := s.orders.Create(items)
+	if err != nil {
+		s.logger.Error("create order", "error", err)
+	}
+	return order, err
+}
+
+func (s *Service) CancelOrder(id int) error {
+	err := s.orders.Cancel(id)
+	if err != nil {
+		s.logger.Error("cancel order", "error", err)
+	}
+	return err
+}
+
+func (s *Service) GetOrder(id int) (Order, error) {
+	return s.orders.Get(id)
+}
+
+func (s *Service) GetOrders() []Order {
+	return s.orders.List()
+}
+
+func (s *Service) GetActiveOrder() (Order, error) {
+	return s.orders.Active()
+}
@@ -1,16 +1,24 @@
 package core
 
 type Actuator interface {
+	GetName() string
 	IsActivated() bool
 	Activate()
 	Deactivate()
 }
 
 type Sensor interface {
+	GetName() string
 	GetValue() bool
 	WriteValue(newValue bool)
 }
 
+type Encoder interface {
+	GetName() string
+	GetValue() int64
+	WriteValue(newValue int64)
+}
+
 type Pucker interface {
 	TakePuck() (Puck, error)
 	PlacePuck(puck Puck) error
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+type ResetOptions struct {
+	KeepStatistics bool   // keep produced pucks and counters
+	KeepFaults     bool   // keep alarms
+	KeepOrders     bool   // keep order queue
+	KeepDebug      bool   // keep breakpoints and trace buffer
+	Seed           *int64 // reseed puck generator if set
+}
+
+// returns line to its initial state, running station operations are aborted,
+// sensor models forget their input history
+func (s *Service) Reset(opts ResetOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.haltGripper()
+	s.waitStationsIdle()
+
+	lost := len(s.allPucks())
+	s.pucksLost += lost
+	s.analytics.PucksLost(lost)
+	stats := s.statistics()
+	produced := s.SortingLine.Produced
+
+	s.Gripper.IsOpen = false
+	s.Gripper.PuckSlot = nil
+	s.Gripper.CurHorizontalPosition = gripperStartPos
+	s.Gripper.CurVerticalPosition = gripperUpPos
+
+	s.Start = NewStart()
+	s.Carousel = NewCarousel(s.clock)
+	s.PackagingLine = NewPackagingLine(s.clock)
+	s.SortingLine = NewSortingLine(s.clock)
+
+	for _, actuator := range s.actuators {
+		actuator.Deactivate()
+	}
+
+	if s.initialState != nil {
+		s.applySnapshot(*s.initialState)
+	}
+
+	if opts.KeepStatistics {
+		s.SortingLine.Produced = produced
+		s.Carousel.Rotations = stats.CarouselRotations
+		s.Carousel.BusyTime = stats.BusyTime[StationCarousel]
+		s.PackagingLine.BusyTime = stats.BusyTime[StationPackaging]
+		s.SortingLine.BusyTime = stats.BusyTime[StationSorting]
+	} else {
+		s.pucksCreated = 0
+		s.pucksLost = 0
+		s.pucksScrapped = make(map[string]int)
+		s.Gripper.HorizontalTravel = 0
+		s.Gripper.VerticalTravel = 0
+		s.Gripper.BusyTime = 0
+		s.analytics.Start()
+	}
+
+	if !opts.KeepFaults {
+		s.alarms.Reset()
+	}
+
+	if !opts.KeepOrders {
+		s.orders.Clear()
+	}
+
+	if !opts.KeepDebug {
+		s.debugger.Clear()
+		s.trace.Clear()
+	}
+
+	s.modelsMu.Lock()
+	for _, m := range s.switches {
+		m.reset()
+	}
+	s.modelsMu.Unlock()
+	s.sensorMismatch = make(map[string]time.Time)
+
+	if opts.Seed != nil {
+		s.rngMu.Lock()
+		s.rng = rand.New(rand.NewSource(*opts.Seed))
+		s.seed = *opts.Seed
+		s.rngMu.Unlock()
+
+		s.modelsMu.Lock()
+		s.noiseRng = rand.New(rand.NewSource(*opts.Seed + noiseSeedOffset))
+		s.modelsMu.Unlock()
+	}
+
+	data := map[string]any{
+		"keepStatistics": opts.KeepStatistics,
+		"keepFaults":     opts.KeepFaults,
+		"keepOrders":     opts.KeepOrders,
+		"keepDebug":      opts.KeepDebug,
+	}
+	if opts.Seed != nil {
+		data["seed"] = *opts.Seed
+	}
+	s.events.Add(EventReset, "line", "line reset to initial state", data)
+}
+
+// aborts station operations and waits until they end, also on paused clock, should be called with mu held
+func (s *Service) waitStationsIdle() {
+	s.cancelStations()
+	for s.Carousel.IsRotating || s.PackagingLine.IsPackaging || s.SortingLine.IsSorting {
+		s.stationsIdle.Wait()
+	}
+	s.stations, s.cancelStations = context.WithCancel(context.Background())
+}
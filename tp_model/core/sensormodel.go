@@ -0,0 +1,212 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultEncoderResolution = 0.0001 // m per count
+
+	maxSensorDelay       = 10 * time.Second
+	maxSensorHysteresis  = 0.1  // m
+	maxEncoderResolution = 0.01 // m per count
+	maxEncoderNoise      = 0.1  // m
+
+	noiseSeedOffset = 1 // noise generator is seeded with line seed plus it
+)
+
+// characteristics of switching sensor, ideal sensor has all of them zero
+type SensorCharacteristics struct {
+	Delay      time.Duration // output follows input only after input holds that long
+	Hysteresis float64       // m, sensor switches off that much farther from target than it switches on
+	Bounce     time.Duration // output chatters that long after each edge
+}
+
+// characteristics of linear encoder
+type EncoderCharacteristics struct {
+	Resolution float64 // m per count
+	Noise      float64 // m, standard deviation of measured position
+}
+
+// state of switching sensor between ideal input and output
+type switchModel struct {
+	SensorCharacteristics
+	active      bool // input after hysteresis
+	pending     bool // input not yet passed through delay
+	changedAt   time.Time
+	stable      bool // input after delay
+	bounceUntil time.Time
+}
+
+// output of sensor on tick, target is reached within gripperAbleMiss of distance
+func (m *switchModel) update(distance float64, now time.Time, rng *rand.Rand) bool {
+	if m.active {
+		m.active = distance <= gripperAbleMiss+m.Hysteresis
+	} else {
+		m.active = distance <= gripperAbleMiss
+	}
+
+	if m.active != m.pending {
+		m.pending = m.active
+		m.changedAt = now
+	}
+	if m.pending != m.stable && now.Sub(m.changedAt) >= m.Delay {
+		m.stable = m.pending
+		m.bounceUntil = now.Add(m.Bounce)
+	}
+
+	// contacts open and close at random while bouncing
+	if now.Before(m.bounceUntil) && rng.Intn(2) == 0 {
+		return !m.stable
+	}
+	return m.stable
+}
+
+// forgets input history, characteristics are kept
+func (m *switchModel) reset() {
+	*m = switchModel{SensorCharacteristics: m.SensorCharacteristics}
+}
+
+type encoderModel struct {
+	EncoderCharacteristics
+	position func() float64
+}
+
+// counts of encoder on tick
+func (m *encoderModel) read(rng *rand.Rand) int64 {
+	pos := m.position()
+	if m.Noise > 0 {
+		pos += rng.NormFloat64() * m.Noise
+	}
+	return int64(math.Round(pos / m.Resolution))
+}
+
+func validateSensorCharacteristics(c SensorCharacteristics) error {
+	if c.Delay < 0 || c.Delay > maxSensorDelay {
+		return fmt.Errorf("%w: delay should be from 0 to %s", ErrSensorCharacteristicsInvalid, maxSensorDelay)
+	}
+	if c.Bounce < 0 || c.Bounce > maxSensorDelay {
+		return fmt.Errorf("%w: bounce should be from 0 to %s", ErrSensorCharacteristicsInvalid, maxSensorDelay)
+	}
+	if c.Hysteresis < 0 || c.Hysteresis > maxSensorHysteresis {
+		return fmt.Errorf("%w: hysteresis should be from 0 to %g m", ErrSensorCharacteristicsInvalid, maxSensorHysteresis)
+	}
+	return nil
+}
+
+func validateEncoderCharacteristics(c EncoderCharacteristics) error {
+	if c.Resolution <= 0 || c.Resolution > maxEncoderResolution {
+		return fmt.Errorf("%w: resolution should be above 0 and up to %g m", ErrSensorCharacteristicsInvalid, maxEncoderResolution)
+	}
+	if c.Noise < 0 || c.Noise > maxEncoderNoise {
+		return fmt.Errorf("%w: noise should be from 0 to %g m", ErrSensorCharacteristicsInvalid, maxEncoderNoise)
+	}
+	return nil
+}
+
+func (s *Service) GetSensorCharacteristics(sensorId string) (SensorCharacteristics, error) {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+
+	m, found := s.switches[sensorId]
+	if !found {
+		return SensorCharacteristics{}, ErrSensorNotFound
+	}
+	return m.SensorCharacteristics, nil
+}
+
+func (s *Service) SetSensorCharacteristics(sensorId string, c SensorCharacteristics) error {
+	if err := validateSensorCharacteristics(c); err != nil {
+		return err
+	}
+
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+
+	m, found := s.switches[sensorId]
+	if !found {
+		return ErrSensorNotFound
+	}
+	m.SensorCharacteristics = c
+
+	return nil
+}
+
+func (s *Service) GetEncoderValue(encoderId string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	encoder, found := s.encoders[encoderId]
+	if !found {
+		return 0, ErrEncoderNotFound
+	}
+
+	return encoder.GetValue(), nil
+}
+
+// current counts of all encoders, encoder id -> value
+func (s *Service) EncoderValues() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[string]int64, len(s.encoders))
+	for id, encoder := range s.encoders {
+		res[id] = encoder.GetValue()
+	}
+	return res
+}
+
+func (s *Service) GetEncoderCharacteristics(encoderId string) (EncoderCharacteristics, error) {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+
+	m, found := s.encoderModels[encoderId]
+	if !found {
+		return EncoderCharacteristics{}, ErrEncoderNotFound
+	}
+	return m.EncoderCharacteristics, nil
+}
+
+func (s *Service) SetEncoderCharacteristics(encoderId string, c EncoderCharacteristics) error {
+	if err := validateEncoderCharacteristics(c); err != nil {
+		return err
+	}
+
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+
+	m, found := s.encoderModels[encoderId]
+	if !found {
+		return ErrEncoderNotFound
+	}
+	m.EncoderCharacteristics = c
+
+	return nil
+}
+
+// sensors of line see gripper through their characteristics, sensors are updated
+// in fixed order so random bounce and noise are the same for the same seed
+func (s *Service) updateSensors() {
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+
+	now := s.clock.Now()
+	curGripperPos := s.Gripper.CurHorizontalPosition
+
+	s.updateSwitch("ns:1, i:1", math.Abs(gripperCarouselPos-curGripperPos), now)
+	s.updateSwitch("ns:1, i:2", math.Abs(gripperStartPos-curGripperPos), now)
+	s.updateSwitch("ns:1, i:3", math.Abs(gripperPackagingPos-curGripperPos), now)
+	s.updateSwitch("ns:1, i:4", math.Abs(gripperSortingPos-curGripperPos), now)
+
+	s.updateEncoder("ns:1, i:18")
+	s.updateEncoder("ns:1, i:19")
+}
+
+func (s *Service) updateSwitch(sensorId string, distance float64, now time.Time) {
+	s.sensors[sensorId].WriteValue(s.switches[sensorId].update(distance, now, s.noiseRng))
+}
+
+func (s *Service) updateEncoder(encoderId string) {
+	s.encoders[encoderId].WriteValue(s.encoderModels[encoderId].read(s.noiseRng))
+}
@@ -1,20 +1,77 @@
 package core
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"log/slog"
 	"math"
 	"math/rand"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Razzle131/line316/tp_model/adapters/actuator"
 	"github.com/Razzle131/line316/tp_model/adapters/sensor"
 )
 
+type Options struct {
+	ControlLease     time.Duration // how long control is held without commands or heartbeat
+	WatchdogTimeout  time.Duration // safe stop after no commands for that long, disabled if zero
+	FastMode         bool          // discrete-event simulation on virtual clock, time moves only while controller waits
+	HistoryRetention time.Duration // how long past line states are kept for time travel, disabled if zero
+	IdealCycleTime   time.Duration // cycle time of good controller for analytics performance, default if zero
+	Seed             int64         // seed of line random generator, taken from wall clock if zero
+
+	Sensors  map[string]SensorCharacteristics  // sensor id -> characteristics, sensors not listed are ideal
+	Encoders map[string]EncoderCharacteristics // encoder id -> characteristics
+	Motion   MotionProfile                     // gripper kinematics, ideal if zero
+}
+
 type Service struct {
 	logger *slog.Logger
 
-	// actuators map[string]Actuator // addr -> obj
-	sensors map[string]Sensor // addr -> obj
+	// line state below is guarded by mu, it is held by every command and by clock actions like tick and gripper motion
+	mu sync.Mutex
+
+	actuators map[string]Actuator // addr -> obj
+	sensors   map[string]Sensor   // addr -> obj
+	encoders  map[string]Encoder  // addr -> obj
+
+	modelsMu      sync.Mutex
+	switches      map[string]*switchModel // sensor id -> characteristics
+	encoderModels map[string]*encoderModel
+	noiseRng      *rand.Rand // bounce and noise of sensors, used on tick only, so noise does not change puck supply
+
+	clock     *Clock
+	events    *EventLog
+	alarms    *AlarmManager
+	control   *ControlLock
+	watchdog  *Watchdog
+	analytics *Analytics
+	orders    *OrderBook
+	trace     *Trace
+	debugger  *Debugger
+	history   *History     // nil if disabled
+	probes    []traceProbe // signals of line read every tick
+	rngMu     sync.Mutex
+	rng       *rand.Rand // puck supply, same seed and commands give same run
+	seed      int64
+
+	sensorMismatch map[string]time.Time // sensor id -> since when its value contradicts gripper position
+
+	stations       context.Context // station operations are aborted when it is cancelled on reset
+	cancelStations context.CancelFunc
+	stationsIdle   *sync.Cond // broadcast with mu held when station operation ends
+
+	initialState *Snapshot // line state to return to on reset, default stations if nil
+
+	lastPuckId    int
+	pucksCreated  int
+	pucksLost     int
+	pucksScrapped map[string]int // reason -> pucks
+
+	done chan struct{} // closed on service close to stop background loops
 
 	Gripper       Gripper
 	Start         Start
@@ -23,16 +80,47 @@ type Service struct {
 	SortingLine   SortingLine
 }
 
-func NewService(logger *slog.Logger) *Service {
+func NewService(logger *slog.Logger, opts Options) *Service {
+	clock := NewRealClock()
+	if opts.FastMode {
+		clock = NewVirtualClock(time.Now())
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	events := NewEventLog(clock)
 	s := Service{
-		logger:        logger,
-		sensors:       make(map[string]Sensor),
-		Gripper:       NewGripper(),
-		Start:         NewStart(),
-		Carousel:      NewCarousel(),
-		PackagingLine: NewPackagingLine(),
-		SortingLine:   NewSortingLine(),
+		logger:         logger,
+		clock:          clock,
+		actuators:      make(map[string]Actuator),
+		sensors:        make(map[string]Sensor),
+		encoders:       make(map[string]Encoder),
+		switches:       make(map[string]*switchModel),
+		encoderModels:  make(map[string]*encoderModel),
+		sensorMismatch: make(map[string]time.Time),
+		pucksScrapped:  make(map[string]int),
+		events:         events,
+		alarms:         NewAlarmManager(events, clock),
+		control:        NewControlLock(opts.ControlLease, events, clock),
+		watchdog:       NewWatchdog(opts.WatchdogTimeout, clock),
+		analytics:      NewAnalytics(opts.IdealCycleTime, clock),
+		orders:         NewOrderBook(events, clock),
+		rng:            rand.New(rand.NewSource(seed)),
+		noiseRng:       rand.New(rand.NewSource(seed + noiseSeedOffset)),
+		seed:           seed,
+		done:           make(chan struct{}),
+		Gripper:        NewGripper(clock),
+		Start:          NewStart(),
+		Carousel:       NewCarousel(clock),
+		PackagingLine:  NewPackagingLine(clock),
+		SortingLine:    NewSortingLine(clock),
 	}
+	clock.SetLocker(&s.mu)
+	s.stations, s.cancelStations = context.WithCancel(context.Background())
+	s.stationsIdle = sync.NewCond(&s.mu)
 
 	// // Processing station PLC sensors
 	// s.sensors["ns:4, i:5"] = sensor.New("processing_input_4_workpiece_detected", "ns:4, i:5")
@@ -61,9 +149,6 @@ func NewService(logger *slog.Logger) *Service {
 	// s.actuators["ns:4, i:17"] = actuator.New("processing_output_5_detect_hole", "ns:4, i:17")
 
 	// // Handling and Packing PLC actuators
-	// s.actuators["ns:4, i:34"] = actuator.New("handling_output_0_to_green", "ns:4, i:34")
-	// s.actuators["ns:4, i:35"] = actuator.New("handling_output_1_to_yellow", "ns:4, i:35")
-	// s.actuators["ns:4, i:36"] = actuator.New("handling_output_2_to_red", "ns:4, i:36")
 	// s.actuators["ns:4, i:37"] = actuator.New("handling_output_3_gripper_to_right", "ns:4, i:37")
 	// s.actuators["ns:4, i:38"] = actuator.New("handling_output_4_gripper_to_left", "ns:4, i:38")
 	// s.actuators["ns:4, i:39"] = actuator.New("handling_output_5_gripper_to_down", "ns:4, i:39")
@@ -84,13 +169,120 @@ func NewService(logger *slog.Logger) *Service {
 	s.sensors["ns:1, i:2"] = sensor.New("gripper start position", "ns:1, i:2")
 	s.sensors["ns:1, i:3"] = sensor.New("gripper packaging position", "ns:1, i:3")
 	s.sensors["ns:1, i:4"] = sensor.New("gripper sorting position", "ns:1, i:4")
+	for id := range s.sensors {
+		s.switches[id] = &switchModel{}
+	}
+
+	// linear encoders of gripper axes
+	s.encoders["ns:1, i:18"] = sensor.NewEncoder("gripper horizontal encoder", "ns:1, i:18")
+	s.encoders["ns:1, i:19"] = sensor.NewEncoder("gripper vertical encoder", "ns:1, i:19")
+	s.encoderModels["ns:1, i:18"] = &encoderModel{
+		EncoderCharacteristics: EncoderCharacteristics{Resolution: defaultEncoderResolution},
+		position:               func() float64 { return s.Gripper.CurHorizontalPosition },
+	}
+	s.encoderModels["ns:1, i:19"] = &encoderModel{
+		EncoderCharacteristics: EncoderCharacteristics{Resolution: defaultEncoderResolution},
+		position:               func() float64 { return s.Gripper.CurVerticalPosition },
+	}
+
+	if err := s.SetMotionProfile(opts.Motion); err != nil {
+		logger.Error("motion profile", "error", err)
+	}
+
+	for id, c := range opts.Sensors {
+		if err := s.SetSensorCharacteristics(id, c); err != nil {
+			logger.Error("sensor characteristics", "sensorId", id, "error", err)
+		}
+	}
+	for id, c := range opts.Encoders {
+		if c.Resolution == 0 {
+			c.Resolution = defaultEncoderResolution
+		}
+		if err := s.SetEncoderCharacteristics(id, c); err != nil {
+			logger.Error("encoder characteristics", "encoderId", id, "error", err)
+		}
+	}
 
-	go s.updateSensors()
+	// signal tower and operator panel
+	s.actuators["ns:4, i:34"] = actuator.New("handling_output_0_to_green", "ns:4, i:34")
+	s.actuators["ns:4, i:35"] = actuator.New("handling_output_1_to_yellow", "ns:4, i:35")
+	s.actuators["ns:4, i:36"] = actuator.New("handling_output_2_to_red", "ns:4, i:36")
+	s.actuators["ns:1, i:5"] = actuator.New("panel start button lamp", "ns:1, i:5")
+	s.actuators["ns:1, i:6"] = actuator.New("panel reset button lamp", "ns:1, i:6")
+
+	s.probes = s.traceProbes()
+	signals := make([]TraceSignal, 0, len(s.probes))
+	for _, p := range s.probes {
+		signals = append(signals, p.signal)
+	}
+	s.trace = NewTrace(signals, events, clock)
+	s.debugger = NewDebugger(signals, events, clock)
+	if opts.HistoryRetention > 0 {
+		s.history = NewHistory(opts.HistoryRetention)
+	}
+
+	s.events.Add(EventSeeded, "line", fmt.Sprintf("random generator seeded with %d", seed), map[string]any{"seed": seed})
+
+	s.clock.Every(time.Second/tickrate, s.tick)
+	if !s.clock.IsVirtual() {
+		go s.clock.Run(s.done)
+	}
 	//go s.printGripperPos()
 
 	return &s
 }
 
+// stops gripper and background loops, service should not be used after
+func (s *Service) Close() {
+	s.Gripper.Stop()
+	close(s.done)
+	s.clock.Resume() // so nothing waits for paused clock forever
+	s.events.Close()
+}
+
+// closed when service is closed
+func (s *Service) Done() <-chan struct{} {
+	return s.done
+}
+
+// seed random generator of line was last seeded with
+func (s *Service) Seed() int64 {
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
+	return s.seed
+}
+
+// simulation time, it is wall time unless service runs in fast mode
+func (s *Service) Now() time.Time {
+	return s.clock.Now()
+}
+
+// waits for d of simulation time, in fast mode line is simulated meanwhile
+func (s *Service) Sleep(ctx context.Context, d time.Duration) error {
+	return s.clock.Sleep(ctx, d)
+}
+
+// background logic of line done every tick, clock runs it with mu held
+func (s *Service) tick() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+
+	s.updateSensors()
+	s.updateAlarms()
+	s.analytics.sample(s.stationStates(), s.alarms.HasFault())
+	values := s.readProbes()
+	s.trace.sample(values)
+	s.debugger.check(values)
+	if s.history != nil {
+		s.history.record(s)
+	}
+
+	return true
+}
+
 func (s *Service) printGripperPos() {
 	ticker := time.NewTicker(time.Millisecond * 100)
 	for range ticker.C {
@@ -98,55 +290,242 @@ func (s *Service) printGripperPos() {
 	}
 }
 
-func (s *Service) updateSensors() {
-	ticker := time.NewTicker(time.Second / tickrate)
-	for range ticker.C {
-		curGripperPos := s.Gripper.CurHorizontalPosition
-		if math.Abs(gripperCarouselPos-curGripperPos) <= gripperAbleMiss {
-			s.sensors["ns:1, i:1"].WriteValue(true)
-		} else {
-			s.sensors["ns:1, i:1"].WriteValue(false)
-		}
+func (s *Service) updateAlarms() {
+	gripperIsLow := s.Gripper.CurVerticalPosition < gripperSafeHeight
+	gripperAtCarousel := math.Abs(gripperCarouselPos-s.Gripper.CurHorizontalPosition) <= gripperAbleMiss
 
-		if math.Abs(gripperStartPos-curGripperPos) <= gripperAbleMiss {
-			s.sensors["ns:1, i:2"].WriteValue(true)
-		} else {
-			s.sensors["ns:1, i:2"].WriteValue(false)
-		}
+	s.alarms.Set(AlarmGripperCollision, AlarmSeverityCritical, "gripper",
+		"gripper collision: moving horizontally or rotating carousel while gripper is down",
+		gripperIsLow && (s.Gripper.IsMovingHorizontaly || (gripperAtCarousel && s.Carousel.IsRotating)))
 
-		if math.Abs(gripperPackagingPos-curGripperPos) <= gripperAbleMiss {
-			s.sensors["ns:1, i:3"].WriteValue(true)
-		} else {
-			s.sensors["ns:1, i:3"].WriteValue(false)
+	s.alarms.Set(AlarmBinFull, AlarmSeverityWarning, "sorting",
+		"sorting bin is full",
+		s.SortingLine.IsBinFull())
+
+	s.alarms.Set(AlarmInvariantViolated, AlarmSeverityError, "gripper",
+		"puck is held by open gripper",
+		s.Gripper.IsOpen && s.Gripper.PuckSlot != nil)
+
+	stuck := s.stuckSensors()
+	s.alarms.Set(AlarmSensorStuck, AlarmSeverityError, "sensors",
+		fmt.Sprintf("sensor stuck: %s contradicts gripper position", strings.Join(stuck, ", ")),
+		len(stuck) > 0)
+
+	if s.watchdog.Expired() {
+		s.safeStop()
+	}
+}
+
+// names of position sensors whose value contradicts gripper position for longer than
+// sensorStuckTimeout plus their own delay and bounce, sorted
+func (s *Service) stuckSensors() []string {
+	now := s.clock.Now()
+	res := make([]string, 0)
+
+	for id, pos := range positionSensors {
+		c, _ := s.GetSensorCharacteristics(id)
+		distance := math.Abs(pos - s.Gripper.CurHorizontalPosition)
+		value := s.sensors[id].GetValue()
+
+		// within hysteresis band both values are right
+		if (value && distance <= gripperAbleMiss+c.Hysteresis) || (!value && distance > gripperAbleMiss) {
+			delete(s.sensorMismatch, id)
+			continue
 		}
 
-		if math.Abs(gripperSortingPos-curGripperPos) <= gripperAbleMiss {
-			s.sensors["ns:1, i:4"].WriteValue(true)
-		} else {
-			s.sensors["ns:1, i:4"].WriteValue(false)
+		since, found := s.sensorMismatch[id]
+		if !found {
+			s.sensorMismatch[id] = now
+			continue
+		}
+		if now.Sub(since) > sensorStuckTimeout+c.Delay+c.Bounce {
+			res = append(res, s.sensors[id].GetName())
 		}
 	}
+	sort.Strings(res)
+
+	return res
+}
+
+// de-energises all actuators and stops motion, like plc outputs on fieldbus watchdog timeout
+func (s *Service) safeStop() {
+	s.logger.Warn("watchdog timeout, stopping line")
+
+	s.haltGripper()
+	for _, actuator := range s.actuators {
+		actuator.Deactivate()
+	}
+
+	s.alarms.Raise(AlarmWatchdog, AlarmSeverityCritical, "watchdog", "communication watchdog timeout, line stopped")
+}
+
+// any command from controller counts as heartbeat
+func (s *Service) FeedWatchdog() {
+	s.watchdog.Feed()
+	s.alarms.Clear(AlarmWatchdog)
+}
+
+// watchdog does not trip while client waits on line, it is fed when returned func is called
+func (s *Service) HoldWatchdog() func() {
+	return s.watchdog.Hold()
+}
+
+func (s *Service) GetWatchdogStatus() WatchdogStatus {
+	return s.watchdog.Status()
 }
 
 func (s *Service) GetSensorValue(sensorId string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	sensor, found := s.sensors[sensorId]
 	if !found {
-		return false, errors.New("sensor not found")
+		return false, ErrSensorNotFound
 	}
 
 	return sensor.GetValue(), nil
 }
 
+// current values of all sensors, sensor id -> value
+func (s *Service) SensorValues() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string]bool, len(s.sensors))
+	for id, sensor := range s.sensors {
+		res[id] = sensor.GetValue()
+	}
+	return res
+}
+
+func (s *Service) GetActuatorValue(actuatorId string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	actuator, found := s.actuators[actuatorId]
+	if !found {
+		return false, ErrActuatorNotFound
+	}
+
+	return actuator.IsActivated(), nil
+}
+
+func (s *Service) SetActuatorValue(actuatorId string, value bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	actuator, found := s.actuators[actuatorId]
+	if !found {
+		return ErrActuatorNotFound
+	}
+
+	if actuator.IsActivated() == value {
+		return nil
+	}
+
+	if value {
+		actuator.Activate()
+	} else {
+		actuator.Deactivate()
+	}
+
+	s.events.Add(EventActuator, actuatorId, actuator.GetName(), map[string]any{"value": value})
+
+	return nil
+}
+
+func (s *Service) GetLights() Lights {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Lights{
+		Green:       s.actuators["ns:4, i:34"].IsActivated(),
+		Yellow:      s.actuators["ns:4, i:35"].IsActivated(),
+		Red:         s.actuators["ns:4, i:36"].IsActivated(),
+		StartButton: s.actuators["ns:1, i:5"].IsActivated(),
+		ResetButton: s.actuators["ns:1, i:6"].IsActivated(),
+	}
+}
+
+func (s *Service) GetEvents(since uint64) []Event {
+	return s.events.Since(since)
+}
+
+func (s *Service) LastEventSeq() uint64 {
+	return s.events.LastSeq()
+}
+
+func (s *Service) SubscribeEvents() (<-chan Event, func()) {
+	return s.events.Subscribe()
+}
+
+func (s *Service) GetAlarms() []Alarm {
+	return s.alarms.List()
+}
+
+func (s *Service) AcknowledgeAlarm(alarmId string) error {
+	err := s.alarms.Acknowledge(alarmId)
+	if err != nil {
+		s.logger.Error("acknowledge alarm", "error", err)
+	}
+	return err
+}
+
+func (s *Service) AcknowledgeAllAlarms() {
+	s.alarms.AcknowledgeAll()
+}
+
+func (s *Service) AcquireControl(owner string) (ControlLease, error) {
+	lease, err := s.control.Acquire(owner)
+	if err != nil {
+		s.logger.Error("acquire control", "error", err)
+	}
+	return lease, err
+}
+
+func (s *Service) SeizeControl(owner string) (ControlLease, error) {
+	return s.control.Seize(owner)
+}
+
+func (s *Service) HeartbeatControl(token string) (ControlLease, error) {
+	return s.control.Heartbeat(token)
+}
+
+func (s *Service) ReleaseControl(token string) error {
+	return s.control.Release(token)
+}
+
+func (s *Service) CheckControl(token string) error {
+	return s.control.Check(token)
+}
+
+func (s *Service) GetControl() (ControlLease, bool) {
+	return s.control.Current()
+}
+
 func (s *Service) PlaceNewStartPuck() error {
-	colors := []string{"red", "silver", "black"}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rngMu.Lock()
+	defer s.rngMu.Unlock()
 
-	puck := NewPuck(colors[rand.Intn(len(colors))])
+	puck := NewPuck(s.lastPuckId+1, puckColors[s.rng.Intn(len(puckColors))])
 	err := s.Start.PlacePuck(puck)
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.lastPuckId++
+	s.pucksCreated++
+	s.analytics.PuckCreated(puck)
+
+	return nil
 }
 
 func (s *Service) MoveGripperLeft() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	err := s.Gripper.MoveLeft()
 	if err != nil {
 		s.logger.Error("move left", "err", err)
@@ -155,6 +534,9 @@ func (s *Service) MoveGripperLeft() error {
 }
 
 func (s *Service) MoveGripperRight() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	err := s.Gripper.MoveRight()
 	if err != nil {
 		s.logger.Error("move right", "err", err)
@@ -163,6 +545,9 @@ func (s *Service) MoveGripperRight() error {
 }
 
 func (s *Service) MoveGripperUp() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	err := s.Gripper.MoveUp()
 	if err != nil {
 		s.logger.Error("move up", "err", err)
@@ -171,6 +556,9 @@ func (s *Service) MoveGripperUp() error {
 }
 
 func (s *Service) MoveGripperDown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	err := s.Gripper.MoveDown()
 	if err != nil {
 		s.logger.Error("move down", "err", err)
@@ -179,12 +567,15 @@ func (s *Service) MoveGripperDown() error {
 }
 
 func (s *Service) OpenGripper() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.Gripper.Open()
 
 	var err error
 	if s.Gripper.PuckSlot != nil {
 		if s.Gripper.CurVerticalPosition > gripperDownPos {
-			err = errors.New("opening gripper with puck in higher than lower position")
+			err = ErrGripperNotDown
 		} else {
 			err = s.placePuck()
 			if err != nil {
@@ -197,6 +588,9 @@ func (s *Service) OpenGripper() error {
 }
 
 func (s *Service) CloseGripper() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	var err error
 	if s.Gripper.PuckSlot == nil && s.Gripper.CurVerticalPosition <= gripperDownPos {
 		err = s.takePuck()
@@ -218,6 +612,14 @@ func (s *Service) EnableMovingGripper() {
 	s.Gripper.EnableMoving()
 }
 
+// stops gripper at once without braking, works on paused clock too
+func (s *Service) HaltGripper() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.haltGripper()
+}
+
 func (s *Service) takePuck() error {
 	curGripperPos := s.Gripper.CurHorizontalPosition
 	var pucker Pucker
@@ -228,9 +630,9 @@ func (s *Service) takePuck() error {
 	} else if math.Abs(gripperPackagingPos-curGripperPos) <= gripperAbleMiss {
 		pucker = &s.PackagingLine
 	} else if math.Abs(gripperSortingPos-curGripperPos) <= gripperAbleMiss {
-		return errors.New("should not take puck from sorting line")
+		return ErrTakeFromSorting
 	} else {
-		return errors.New("no position matched for gripper")
+		return ErrNoStationAtPosition
 	}
 
 	puck, err := pucker.TakePuck()
@@ -267,7 +669,7 @@ func (s *Service) placePuck() error {
 	} else if math.Abs(gripperSortingPos-curGripperPos) <= gripperAbleMiss {
 		pucker = &s.SortingLine
 	} else {
-		return errors.New("no position matched for gripper")
+		return ErrNoStationAtPosition
 	}
 
 	err = pucker.PlacePuck(puck)
@@ -280,11 +682,42 @@ func (s *Service) placePuck() error {
 	return nil
 }
 
-func (s *Service) RotateCarousel() {
-	s.Carousel.RotateOnce()
+func (s *Service) RotateCarousel(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.stationOp(ctx, s.Carousel.RotateOnce)
+	if err != nil {
+		s.logger.Error("rotate carousel", "error", err)
+	}
+	return err
+}
+
+// runs timed station operation, it is refused while simulation is paused and aborted by reset, should be called with mu held
+func (s *Service) stationOp(ctx context.Context, op func(ctx context.Context) error) error {
+	if s.clock.IsPaused() {
+		return ErrSimulationPaused
+	}
+
+	stations := s.stations
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(stations, cancel)
+	defer stop()
+
+	defer s.stationsIdle.Broadcast()
+
+	err := op(ctx)
+	if err != nil && stations.Err() != nil {
+		return ErrStationAborted
+	}
+	return err
 }
 
 func (s *Service) InspectPuck() (Puck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	puck, err := s.Carousel.InspectPuck()
 	if err != nil {
 		s.logger.Error("inspect puck", "error", err)
@@ -293,6 +726,9 @@ func (s *Service) InspectPuck() (Puck, error) {
 }
 
 func (s *Service) DrillPuck() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	err := s.Carousel.DrillPuck()
 	if err != nil {
 		s.logger.Error("drill puck", "error", err)
@@ -300,18 +736,49 @@ func (s *Service) DrillPuck() error {
 	return err
 }
 
-func (s *Service) PackagePuck() error {
-	err := s.PackagingLine.PackagePuck()
+func (s *Service) PackagePuck(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.stationOp(ctx, s.PackagingLine.PackagePuck)
 	if err != nil {
 		s.logger.Error("package puck", "error", err)
 	}
 	return err
 }
 
-func (s *Service) SortPuck() error {
-	err := s.SortingLine.SortPuck()
+func (s *Service) SortPuck(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	puck := s.SortingLine.PuckSlot
+	overflowed := s.SortingLine.Overflowed
+
+	err := s.stationOp(ctx, s.SortingLine.SortPuck)
 	if err != nil {
 		s.logger.Error("package puck", "error", err)
+		return err
 	}
-	return err
+
+	s.analytics.PuckSorted(*puck)
+	s.events.Add(EventPuckSorted, "sorting", "puck sorted", map[string]any{"puckId": puck.Id, "color": puck.Color, "isDrilled": puck.IsDrilled})
+	wrongVariant := s.orders.PuckSorted(*puck)
+	if wrongVariant {
+		s.pucksScrapped[ScrapWrongVariant]++
+	}
+	if s.SortingLine.Overflowed > overflowed {
+		s.pucksScrapped[ScrapBinOverflow]++
+	}
+	if wrongVariant || s.SortingLine.Overflowed > overflowed {
+		s.analytics.PuckScrapped(*puck)
+	}
+
+	return nil
+}
+
+func (s *Service) EmptySortingBins() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.SortingLine.EmptyBins()
 }
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	SnapshotVersion = 1
+)
+
+// complete line state, used to save and load scenarios
+type Snapshot struct {
+	Version   int             `json:"version"`
+	TakenAt   time.Time       `json:"takenAt"`
+	Seed      int64           `json:"seed,omitempty"` // informational, restoring snapshot does not reseed line
+	Gripper   GripperState    `json:"gripper"`
+	Start     SlotState       `json:"start"`
+	Carousel  CarouselState   `json:"carousel"`
+	Packaging SlotState       `json:"packaging"`
+	Sorting   SortingState    `json:"sorting"`
+	Actuators map[string]bool `json:"actuators"`
+}
+
+type PuckState struct {
+	Id         int    `json:"id,omitempty"`
+	Color      string `json:"color"`
+	IsDrilled  bool   `json:"isDrilled"`
+	IsPackaged bool   `json:"isPackaged"`
+}
+
+type GripperState struct {
+	IsOpen             bool       `json:"isOpen"`
+	Puck               *PuckState `json:"puck"`
+	HorizontalPosition float64    `json:"horizontalPosition"`
+	VerticalPosition   float64    `json:"verticalPosition"`
+}
+
+type SlotState struct {
+	Puck *PuckState `json:"puck"`
+}
+
+type CarouselState struct {
+	Slots []*PuckState `json:"slots"`
+}
+
+type SortingState struct {
+	Puck      *PuckState             `json:"puck"`
+	Produced  map[string][]PuckState `json:"produced"`
+	BinLevels map[string]int         `json:"binLevels"`
+}
+
+func (s *Service) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// should be called with mu held
+func (s *Service) snapshot() Snapshot {
+	snap := Snapshot{
+		Version: SnapshotVersion,
+		TakenAt: s.clock.Now(),
+		Seed:    s.Seed(),
+		Gripper: GripperState{
+			IsOpen:             s.Gripper.IsOpen,
+			Puck:               puckToState(s.Gripper.PuckSlot),
+			HorizontalPosition: s.Gripper.CurHorizontalPosition,
+			VerticalPosition:   s.Gripper.CurVerticalPosition,
+		},
+		Start: SlotState{
+			Puck: puckToState(s.Start.PuckSlot),
+		},
+		Carousel: CarouselState{
+			Slots: make([]*PuckState, len(s.Carousel.Slots)),
+		},
+		Packaging: SlotState{
+			Puck: puckToState(s.PackagingLine.PuckSlot),
+		},
+		Sorting: SortingState{
+			Puck:      puckToState(s.SortingLine.PuckSlot),
+			Produced:  make(map[string][]PuckState),
+			BinLevels: make(map[string]int),
+		},
+		Actuators: make(map[string]bool),
+	}
+
+	for i, puck := range s.Carousel.Slots {
+		snap.Carousel.Slots[i] = puckToState(puck)
+	}
+
+	for color, pucks := range s.SortingLine.Produced {
+		for _, puck := range pucks {
+			snap.Sorting.Produced[color] = append(snap.Sorting.Produced[color], *puckToState(&puck))
+		}
+	}
+
+	for color, level := range s.SortingLine.BinLevels {
+		snap.Sorting.BinLevels[color] = level
+	}
+
+	for id, actuator := range s.actuators {
+		snap.Actuators[id] = actuator.IsActivated()
+	}
+
+	return snap
+}
+
+// loads snapshot into the line, gripper motion is stopped before
+func (s *Service) Restore(snap Snapshot) error {
+	err := s.ValidateSnapshot(snap)
+	if err != nil {
+		s.logger.Error("restore state", "error", err)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Carousel.IsRotating || s.PackagingLine.IsPackaging || s.SortingLine.IsSorting {
+		s.logger.Error("restore state", "error", ErrLineBusy)
+		return ErrLineBusy
+	}
+
+	s.haltGripper()
+	lost := len(s.allPucks())
+	s.pucksLost += lost
+	s.analytics.PucksLost(lost)
+	s.applySnapshot(snap)
+
+	s.events.Add(EventStateRestored, "line", "line state restored from snapshot", map[string]any{"version": snap.Version})
+
+	return nil
+}
+
+// remembers snapshot as initial state, line is set to it on reset
+func (s *Service) SetInitialState(snap Snapshot) error {
+	err := s.ValidateSnapshot(snap)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initialState = &snap
+
+	return nil
+}
+
+func (s *Service) applySnapshot(snap Snapshot) {
+	s.Gripper.IsOpen = snap.Gripper.IsOpen
+	s.Gripper.PuckSlot = puckFromState(snap.Gripper.Puck)
+	s.Gripper.CurHorizontalPosition = snap.Gripper.HorizontalPosition
+	s.Gripper.CurVerticalPosition = snap.Gripper.VerticalPosition
+
+	s.Start.PuckSlot = puckFromState(snap.Start.Puck)
+
+	s.Carousel.Slots = make([]*Puck, carouselTotalSlots)
+	for i, puck := range snap.Carousel.Slots {
+		s.Carousel.Slots[i] = puckFromState(puck)
+	}
+
+	s.PackagingLine.PuckSlot = puckFromState(snap.Packaging.Puck)
+
+	s.SortingLine.PuckSlot = puckFromState(snap.Sorting.Puck)
+	s.SortingLine.Produced = make(map[string][]Puck)
+	for color, pucks := range snap.Sorting.Produced {
+		for _, puck := range pucks {
+			s.SortingLine.Produced[color] = append(s.SortingLine.Produced[color], *puckFromState(&puck))
+		}
+	}
+	s.SortingLine.BinLevels = make(map[string]int)
+	for color, level := range snap.Sorting.BinLevels {
+		s.SortingLine.BinLevels[color] = level
+	}
+
+	for id, actuator := range s.actuators {
+		if snap.Actuators[id] {
+			actuator.Activate()
+		} else {
+			actuator.Deactivate()
+		}
+	}
+
+	// keep new puck ids unique
+	for _, puck := range s.allPucks() {
+		s.lastPuckId = max(s.lastPuckId, puck.Id)
+	}
+}
+
+// checks snapshot can be restored into line
+func (s *Service) ValidateSnapshot(snap Snapshot) error {
+	if snap.Version != SnapshotVersion {
+		return fmt.Errorf("%w: got %d, want %d", ErrSnapshotInvalid, snap.Version, SnapshotVersion)
+	}
+
+	if snap.Gripper.HorizontalPosition < gripperCarouselPos || snap.Gripper.HorizontalPosition > gripperSortingPos {
+		return fmt.Errorf("%w: gripper horizontal position out of rail", ErrSnapshotInvalid)
+	}
+
+	if snap.Gripper.VerticalPosition < gripperDownPos || snap.Gripper.VerticalPosition > gripperUpPos {
+		return fmt.Errorf("%w: gripper vertical position out of range", ErrSnapshotInvalid)
+	}
+
+	if len(snap.Carousel.Slots) > carouselTotalSlots {
+		return fmt.Errorf("%w: too many carousel slots", ErrSnapshotInvalid)
+	}
+
+	pucks := []*PuckState{snap.Gripper.Puck, snap.Start.Puck, snap.Packaging.Puck, snap.Sorting.Puck}
+	pucks = append(pucks, snap.Carousel.Slots...)
+	for _, puck := range pucks {
+		if puck != nil && !slices.Contains(puckColors, puck.Color) {
+			return fmt.Errorf("%w: unknown puck color %q", ErrSnapshotInvalid, puck.Color)
+		}
+	}
+
+	for color, pucks := range snap.Sorting.Produced {
+		if !slices.Contains(puckColors, color) {
+			return fmt.Errorf("%w: unknown produced puck color %q", ErrSnapshotInvalid, color)
+		}
+		for _, puck := range pucks {
+			if puck.Color != color {
+				return fmt.Errorf("%w: %s puck produced as %s", ErrSnapshotInvalid, puck.Color, color)
+			}
+		}
+	}
+
+	for color, level := range snap.Sorting.BinLevels {
+		if !slices.Contains(puckColors, color) {
+			return fmt.Errorf("%w: unknown bin color %q", ErrSnapshotInvalid, color)
+		}
+		if level < 0 || level > sortingBinCapacity {
+			return fmt.Errorf("%w: %s bin level should be from 0 to %d", ErrSnapshotInvalid, color, sortingBinCapacity)
+		}
+	}
+
+	for id := range snap.Actuators {
+		if _, found := s.actuators[id]; !found {
+			return fmt.Errorf("%w: unknown actuator %q", ErrSnapshotInvalid, id)
+		}
+	}
+
+	return nil
+}
+
+// stops gripper motion at once
+func (s *Service) haltGripper() {
+	s.Gripper.Halt()
+}
+
+func puckToState(puck *Puck) *PuckState {
+	if puck == nil {
+		return nil
+	}
+
+	return &PuckState{
+		Id:         puck.Id,
+		Color:      puck.Color,
+		IsDrilled:  puck.IsDrilled,
+		IsPackaged: puck.IsPackaged,
+	}
+}
+
+func puckFromState(puck *PuckState) *Puck {
+	if puck == nil {
+		return nil
+	}
+
+	return &Puck{
+		Id:         puck.Id,
+		Color:      puck.Color,
+		IsDrilled:  puck.IsDrilled,
+		IsPackaged: puck.IsPackaged,
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import "time"
+
+const (
+	StationGripper   = "gripper"
+	StationCarousel  = "carousel"
+	StationPackaging = "packaging"
+	StationSorting   = "sorting"
+)
+
+// why sorted puck is scrapped instead of being good output
+const (
+	ScrapWrongVariant = "wrong_variant" // not wanted by active order
+	ScrapBinOverflow  = "bin_overflow"  // fell past full bin
+)
+
+type Statistics struct {
+	Produced                map[string]int // color -> pucks sorted
+	PucksCreated            int
+	PucksLost               int            // removed from line by reset or state restore
+	PucksScrapped           map[string]int // reason -> sorted pucks, one puck may be scrapped for several reasons
+	GripperHorizontalTravel float64
+	GripperVerticalTravel   float64
+	CarouselRotations       int
+	BusyTime                map[string]time.Duration // station -> time spent working
+}
+
+func (s *Service) GetStatistics() Statistics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statistics()
+}
+
+// should be called with mu held
+func (s *Service) statistics() Statistics {
+	stats := Statistics{
+		Produced:                make(map[string]int),
+		PucksCreated:            s.pucksCreated,
+		PucksLost:               s.pucksLost,
+		PucksScrapped:           make(map[string]int),
+		GripperHorizontalTravel: s.Gripper.HorizontalTravel,
+		GripperVerticalTravel:   s.Gripper.VerticalTravel,
+		CarouselRotations:       s.Carousel.Rotations,
+		BusyTime: map[string]time.Duration{
+			StationGripper:   s.Gripper.BusyTime,
+			StationCarousel:  s.Carousel.BusyTime,
+			StationPackaging: s.PackagingLine.BusyTime,
+			StationSorting:   s.SortingLine.BusyTime,
+		},
+	}
+
+	for color, pucks := range s.SortingLine.Produced {
+		stats.Produced[color] = len(pucks)
+	}
+	for reason, count := range s.pucksScrapped {
+		stats.PucksScrapped[reason] = count
+	}
+
+	return stats
+}
+
+// pucks currently on the line, sorted ones are not included
+func (s *Service) allPucks() []*Puck {
+	res := make([]*Puck, 0)
+	for _, puck := range []*Puck{s.Gripper.PuckSlot, s.Start.PuckSlot, s.PackagingLine.PuckSlot, s.SortingLine.PuckSlot} {
+		if puck != nil {
+			res = append(res, puck)
+		}
+	}
+	for _, puck := range s.Carousel.Slots {
+		if puck != nil {
+			res = append(res, puck)
+		}
+	}
+	return res
+}
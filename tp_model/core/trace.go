@@ -0,0 +1,435 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	TraceStateIdle      = "idle"
+	TraceStateArmed     = "armed" // waiting for trigger, keeps pre-trigger samples
+	TraceStateRecording = "recording"
+	TraceStateDone      = "done" // buffer filled after trigger or stopped
+)
+
+const (
+	TraceEdgeRising  = "rising"
+	TraceEdgeFalling = "falling"
+	TraceEdgeAny     = "any"
+)
+
+const (
+	TraceKindSensor   = "sensor"
+	TraceKindActuator = "actuator"
+	TraceKindState    = "state" // line state not wired to plc, like gripper motion
+)
+
+const (
+	traceDefaultCapacity = 60 * tickrate      // one minute of ticks
+	traceMaxCapacity     = 60 * 60 * tickrate // one hour of ticks
+	traceMaxBits         = 64
+)
+
+type TraceSignal struct {
+	Id     string // node id for sensors and actuators, name for line state
+	Name   string
+	Kind   string
+	Analog bool
+	Unit   string // of analog signal
+}
+
+// trace starts when bit signal changes
+type TraceTrigger struct {
+	Signal string // signal id
+	Edge   string
+}
+
+type TraceOptions struct {
+	Capacity   int           // samples in buffer, default is used if zero
+	PreTrigger int           // samples before trigger kept in buffer
+	Trigger    *TraceTrigger // recording starts at once if nil, buffer is then overwritten until stop
+}
+
+type TraceStatus struct {
+	State       string
+	Options     TraceOptions
+	Samples     int
+	StartedAt   *time.Time
+	TriggeredAt *time.Time
+}
+
+type TraceSample struct {
+	Time   time.Time
+	Values []float64 // by signal, bits are 0 or 1
+}
+
+type TraceData struct {
+	Signals     []TraceSignal
+	Samples     []TraceSample
+	TriggeredAt *time.Time
+}
+
+// reads one signal of line
+type traceProbe struct {
+	signal TraceSignal
+	bit    func() bool
+	analog func() float64
+}
+
+type traceSample struct {
+	t      time.Time
+	bits   uint64
+	analog []float64
+}
+
+// logic analyser of line, samples every signal every tick into ring buffer
+type Trace struct {
+	mu      sync.Mutex
+	signals []TraceSignal
+	bits    []int // signal index -> bit, -1 for analog signals
+
+	state       string
+	opts        TraceOptions
+	startedAt   *time.Time
+	triggeredAt *time.Time
+	trigger     int // bit of trigger signal
+	prev        *bool
+
+	buf  []traceSample
+	head int // oldest sample
+	n    int
+
+	events *EventLog
+	clock  *Clock
+}
+
+func NewTrace(signals []TraceSignal, events *EventLog, clock *Clock) *Trace {
+	t := &Trace{
+		signals: signals,
+		bits:    make([]int, len(signals)),
+		state:   TraceStateIdle,
+		events:  events,
+		clock:   clock,
+	}
+
+	bit := 0
+	for i, signal := range signals {
+		if signal.Analog {
+			t.bits[i] = -1
+			continue
+		}
+		if bit == traceMaxBits {
+			panic("too many trace bit signals")
+		}
+		t.bits[i] = bit
+		bit++
+	}
+
+	return t
+}
+
+func (t *Trace) Signals() []TraceSignal {
+	return append([]TraceSignal(nil), t.signals...)
+}
+
+// starts new trace, previous samples are dropped
+func (t *Trace) Start(opts TraceOptions) error {
+	if opts.Capacity == 0 {
+		opts.Capacity = traceDefaultCapacity
+	}
+	if opts.Capacity < 0 || opts.Capacity > traceMaxCapacity {
+		return fmt.Errorf("%w: capacity should be from 1 to %d", ErrTraceOptionsInvalid, traceMaxCapacity)
+	}
+
+	trigger := -1
+	if opts.Trigger != nil {
+		trig := *opts.Trigger
+		opts.Trigger = &trig
+
+		for i, signal := range t.signals {
+			if signal.Id == opts.Trigger.Signal {
+				trigger = t.bits[i]
+			}
+		}
+		if trigger == -1 {
+			return fmt.Errorf("%w: no bit signal %q to trigger on", ErrTraceOptionsInvalid, opts.Trigger.Signal)
+		}
+
+		switch opts.Trigger.Edge {
+		case "":
+			opts.Trigger.Edge = TraceEdgeRising
+		case TraceEdgeRising, TraceEdgeFalling, TraceEdgeAny:
+		default:
+			return fmt.Errorf("%w: unknown trigger edge %q", ErrTraceOptionsInvalid, opts.Trigger.Edge)
+		}
+
+		if opts.PreTrigger < 0 || opts.PreTrigger >= opts.Capacity {
+			return fmt.Errorf("%w: pre-trigger samples should be less than capacity", ErrTraceOptionsInvalid)
+		}
+	} else if opts.PreTrigger != 0 {
+		return fmt.Errorf("%w: pre-trigger samples need trigger", ErrTraceOptionsInvalid)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	t.opts = opts
+	t.startedAt = &now
+	t.triggeredAt = nil
+	t.trigger = trigger
+	t.prev = nil
+	t.buf = make([]traceSample, opts.Capacity)
+	t.head, t.n = 0, 0
+
+	t.state = TraceStateRecording
+	if opts.Trigger != nil {
+		t.state = TraceStateArmed
+	}
+
+	return nil
+}
+
+// stops recording, samples are kept for export
+func (t *Trace) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == TraceStateArmed || t.state == TraceStateRecording {
+		t.state = TraceStateDone
+	}
+}
+
+// stops recording and drops samples
+func (t *Trace) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state = TraceStateIdle
+	t.opts = TraceOptions{}
+	t.startedAt = nil
+	t.triggeredAt = nil
+	t.prev = nil
+	t.buf = nil
+	t.head, t.n = 0, 0
+}
+
+func (t *Trace) Status() TraceStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return TraceStatus{
+		State:       t.state,
+		Options:     t.opts,
+		Samples:     t.n,
+		StartedAt:   t.startedAt,
+		TriggeredAt: t.triggeredAt,
+	}
+}
+
+// samples in buffer from oldest
+func (t *Trace) Data() TraceData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data := TraceData{
+		Signals:     append([]TraceSignal(nil), t.signals...),
+		Samples:     make([]TraceSample, 0, t.n),
+		TriggeredAt: t.triggeredAt,
+	}
+
+	for i := 0; i < t.n; i++ {
+		s := t.buf[(t.head+i)%len(t.buf)]
+
+		values := make([]float64, len(t.signals))
+		analog := 0
+		for j, bit := range t.bits {
+			if bit == -1 {
+				values[j] = s.analog[analog]
+				analog++
+			} else if s.bits&(1<<bit) != 0 {
+				values[j] = 1
+			}
+		}
+		data.Samples = append(data.Samples, TraceSample{Time: s.t, Values: values})
+	}
+
+	return data
+}
+
+// records values of signals, called every tick
+func (t *Trace) sample(values []float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state != TraceStateArmed && t.state != TraceStateRecording {
+		return
+	}
+
+	s := traceSample{t: t.clock.Now()}
+	for i, value := range values {
+		if t.bits[i] == -1 {
+			s.analog = append(s.analog, value)
+		} else if value != 0 {
+			s.bits |= 1 << t.bits[i]
+		}
+	}
+
+	if t.state == TraceStateArmed {
+		value := s.bits&(1<<t.trigger) != 0
+		if t.prev == nil || !t.isEdge(*t.prev, value) {
+			t.prev = &value
+			t.push(s)
+			for t.n > t.opts.PreTrigger {
+				t.drop()
+			}
+			return
+		}
+
+		t.state = TraceStateRecording
+		t.triggeredAt = &s.t
+		t.events.Add(EventTraceTriggered, "trace", fmt.Sprintf("trace triggered on %s edge of %s", t.opts.Trigger.Edge, t.opts.Trigger.Signal), map[string]any{
+			"signal": t.opts.Trigger.Signal,
+			"edge":   t.opts.Trigger.Edge,
+		})
+	}
+
+	t.push(s)
+
+	// triggered trace stops when buffer is full, free running one overwrites oldest samples
+	if t.opts.Trigger != nil && t.n == len(t.buf) {
+		t.state = TraceStateDone
+	}
+}
+
+func (t *Trace) isEdge(prev, value bool) bool {
+	switch t.opts.Trigger.Edge {
+	case TraceEdgeRising:
+		return !prev && value
+	case TraceEdgeFalling:
+		return prev && !value
+	}
+	return prev != value
+}
+
+func (t *Trace) push(s traceSample) {
+	if t.n < len(t.buf) {
+		t.buf[(t.head+t.n)%len(t.buf)] = s
+		t.n++
+		return
+	}
+
+	t.buf[t.head] = s
+	t.head = (t.head + 1) % len(t.buf)
+}
+
+func (t *Trace) drop() {
+	t.head = (t.head + 1) % len(t.buf)
+	t.n--
+}
+
+// signals of line in trace: sensors, encoders and actuators by id, then line state
+func (s *Service) traceProbes() []traceProbe {
+	res := make([]traceProbe, 0)
+
+	sensorIds := make([]string, 0, len(s.sensors))
+	for id := range s.sensors {
+		sensorIds = append(sensorIds, id)
+	}
+	sort.Strings(sensorIds)
+	for _, id := range sensorIds {
+		sensor := s.sensors[id]
+		res = append(res, traceProbe{
+			signal: TraceSignal{Id: id, Name: sensor.GetName(), Kind: TraceKindSensor},
+			bit:    sensor.GetValue,
+		})
+	}
+
+	encoderIds := make([]string, 0, len(s.encoders))
+	for id := range s.encoders {
+		encoderIds = append(encoderIds, id)
+	}
+	sort.Strings(encoderIds)
+	for _, id := range encoderIds {
+		encoder := s.encoders[id]
+		res = append(res, traceProbe{
+			signal: TraceSignal{Id: id, Name: encoder.GetName(), Kind: TraceKindSensor, Analog: true, Unit: "counts"},
+			analog: func() float64 { return float64(encoder.GetValue()) },
+		})
+	}
+
+	actuatorIds := make([]string, 0, len(s.actuators))
+	for id := range s.actuators {
+		actuatorIds = append(actuatorIds, id)
+	}
+	sort.Strings(actuatorIds)
+	for _, id := range actuatorIds {
+		actuator := s.actuators[id]
+		res = append(res, traceProbe{
+			signal: TraceSignal{Id: id, Name: actuator.GetName(), Kind: TraceKindActuator},
+			bit:    actuator.IsActivated,
+		})
+	}
+
+	state := func(name string, bit func() bool) traceProbe {
+		return traceProbe{signal: TraceSignal{Id: name, Name: name, Kind: TraceKindState}, bit: bit}
+	}
+	res = append(res,
+		state("gripper_open", func() bool { return s.Gripper.IsOpen }),
+		state("gripper_holding", func() bool { return s.Gripper.PuckSlot != nil }),
+		state("gripper_moving_x", func() bool { return s.Gripper.IsMovingHorizontaly }),
+		state("gripper_moving_y", func() bool { return s.Gripper.IsMovingVerticly }),
+		state("gripper_down", func() bool { return s.Gripper.CurVerticalPosition-gripperDownPos <= gripperAbleMiss }),
+		state("gripper_stop_requested", s.Gripper.IsWantToStopMoving.Load),
+		state("carousel_rotating", func() bool { return s.Carousel.IsRotating }),
+		state("packaging_busy", func() bool { return s.PackagingLine.IsPackaging }),
+		state("sorting_busy", func() bool { return s.SortingLine.IsSorting }),
+	)
+
+	analog := func(name, unit string, value func() float64) traceProbe {
+		return traceProbe{signal: TraceSignal{Id: name, Name: name, Kind: TraceKindState, Analog: true, Unit: unit}, analog: value}
+	}
+	res = append(res,
+		analog("gripper_x", "m", func() float64 { return s.Gripper.CurHorizontalPosition }),
+		analog("gripper_y", "m", func() float64 { return s.Gripper.CurVerticalPosition }),
+		analog("gripper_vx", "m/s", func() float64 { return s.Gripper.HorizontalSpeed }),
+		analog("gripper_vy", "m/s", func() float64 { return s.Gripper.VerticalSpeed }),
+	)
+
+	return res
+}
+
+// current values of probes, bits are 0 or 1
+func (s *Service) readProbes() []float64 {
+	values := make([]float64, len(s.probes))
+	for i, p := range s.probes {
+		if p.analog != nil {
+			values[i] = p.analog()
+		} else if p.bit() {
+			values[i] = 1
+		}
+	}
+	return values
+}
+
+func (s *Service) TraceSignals() []TraceSignal {
+	return s.trace.Signals()
+}
+
+func (s *Service) StartTrace(opts TraceOptions) error {
+	return s.trace.Start(opts)
+}
+
+func (s *Service) StopTrace() {
+	s.trace.Stop()
+}
+
+func (s *Service) GetTraceStatus() TraceStatus {
+	return s.trace.Status()
+}
+
+func (s *Service) GetTrace() TraceData {
+	return s.trace.Data()
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	waitMaxTimeout = time.Minute
+)
+
+// condition over line state, checked every tick while waiting
+type Condition func(s *Service) bool
+
+func SensorCondition(s *Service, sensorId string, value bool) (Condition, error) {
+	if _, found := s.sensors[sensorId]; !found {
+		return nil, ErrSensorNotFound
+	}
+
+	return func(s *Service) bool {
+		return s.sensors[sensorId].GetValue() == value
+	}, nil
+}
+
+func GripperIdleCondition() Condition {
+	return func(s *Service) bool {
+		return !s.Gripper.IsMovingHorizontaly && !s.Gripper.IsMovingVerticly
+	}
+}
+
+// encoder counts are from lo to hi
+func EncoderCondition(s *Service, encoderId string, lo, hi int64) (Condition, error) {
+	if _, found := s.encoders[encoderId]; !found {
+		return nil, ErrEncoderNotFound
+	}
+
+	return func(s *Service) bool {
+		value := s.encoders[encoderId].GetValue()
+		return value >= lo && value <= hi
+	}, nil
+}
+
+func CarouselStoppedCondition() Condition {
+	return func(s *Service) bool {
+		return !s.Carousel.IsRotating
+	}
+}
+
+// puck presence in carousel slot, numeration from zero in carousel gripper pos
+func CarouselSlotCondition(slot int, occupied bool) (Condition, error) {
+	if slot < 0 || slot >= carouselTotalSlots {
+		return nil, ErrBadSlotParam
+	}
+
+	return func(s *Service) bool {
+		return (s.Carousel.Slots[slot] != nil) == occupied
+	}, nil
+}
+
+// blocks until all conditions hold, returns time when they became true
+func (s *Service) WaitFor(ctx context.Context, timeout time.Duration, conds ...Condition) (time.Time, error) {
+	timeout = min(timeout, waitMaxTimeout)
+
+	return s.clock.WaitUntil(ctx, timeout, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.checkConditions(conds)
+	})
+}
+
+func (s *Service) checkConditions(conds []Condition) bool {
+	for _, cond := range conds {
+		if !cond(s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// communication watchdog, armed by first command and tripped when commands stop coming
+type Watchdog struct {
+	mu       sync.Mutex
+	timeout  time.Duration // disabled if zero
+	lastFeed time.Time
+	isArmed  bool
+	holds    int // client waiting on line is alive, watchdog does not trip meanwhile
+	clock    *Clock
+}
+
+type WatchdogStatus struct {
+	Timeout  time.Duration
+	LastFeed time.Time
+	IsArmed  bool
+}
+
+func NewWatchdog(timeout time.Duration, clock *Clock) *Watchdog {
+	return &Watchdog{
+		timeout: timeout,
+		clock:   clock,
+	}
+}
+
+func (w *Watchdog) Feed() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timeout <= 0 {
+		return
+	}
+
+	w.lastFeed = w.clock.Now()
+	w.isArmed = true
+}
+
+// keeps watchdog from tripping until returned func is called, which counts as feed.
+// it does not arm watchdog, observers may wait too
+func (w *Watchdog) Hold() func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.holds++
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.holds--
+		if w.isArmed {
+			w.lastFeed = w.clock.Now()
+		}
+	}
+}
+
+// reports timeout once and disarms until next feed
+func (w *Watchdog) Expired() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.isArmed || w.holds > 0 || w.clock.Now().Sub(w.lastFeed) <= w.timeout {
+		return false
+	}
+
+	w.isArmed = false
+
+	return true
+}
+
+func (w *Watchdog) Status() WatchdogStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return WatchdogStatus{
+		Timeout:  w.timeout,
+		LastFeed: w.lastFeed,
+		IsArmed:  w.isArmed,
+	}
+}
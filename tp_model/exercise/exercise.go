@@ -0,0 +1,242 @@
+package exercise
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+var (
+	ErrExerciseInvalid  = errors.New("invalid exercise definition")
+	ErrExerciseNotFound = errors.New("exercise not found")
+	ErrExerciseRunning  = errors.New("exercise is running already")
+	ErrNoExercise       = errors.New("no exercise was started")
+)
+
+const (
+	GoalSorted          = "sorted"           // at least count sorted pucks of variant
+	GoalAllSorted       = "all_sorted"       // every puck of color is sorted as variant, at least count of them
+	GoalOrdersCompleted = "orders_completed" // at least count orders completed
+)
+
+type Exercise struct {
+	Name         string        `yaml:"name"`
+	Description  string        `yaml:"description"`
+	InitialState string        `yaml:"initial_state"` // snapshot json file, relative to exercise file
+	Seed         *int64        `yaml:"seed"`          // puck supply seed
+	TimeLimit    time.Duration `yaml:"time_limit"`    // no limit if zero
+	Orders       []Order       `yaml:"orders"`        // created on start in queue order
+	Goals        []Goal        `yaml:"goals"`
+	Forbidden    []Forbidden   `yaml:"forbidden"`
+
+	snapshot *core.Snapshot
+}
+
+type Goal struct {
+	Kind    string `yaml:"kind"`
+	Name    string `yaml:"name"`    // shown in report, generated if empty
+	Color   string `yaml:"color"`   // any color if empty
+	Drilled *bool  `yaml:"drilled"` // any if not set
+	Count   int    `yaml:"count"`
+	Points  int    `yaml:"points"` // 1 if zero
+}
+
+type Order struct {
+	Items []OrderItem `yaml:"items"`
+}
+
+type OrderItem struct {
+	Color    string `yaml:"color"`
+	Drilled  bool   `yaml:"drilled"`
+	Quantity int    `yaml:"quantity"`
+}
+
+// event which should not happen during exercise
+type Forbidden struct {
+	Name   string `yaml:"name"`  // shown in report, generated if empty
+	Event  string `yaml:"event"` // event kind
+	Alarm  string `yaml:"alarm"` // alarm id of alarm events, any if empty
+	Points int    `yaml:"points"`
+}
+
+// exercises loaded from yaml files, read only after load
+type Catalog struct {
+	exercises map[string]*Exercise // name -> exercise
+}
+
+// loads all yaml files from dir, missing dir gives empty catalog.
+// initial states are checked against s, lines of server are all alike
+func LoadDir(dir string, s *core.Service) (*Catalog, error) {
+	c := &Catalog{
+		exercises: make(map[string]*Exercise),
+	}
+
+	if dir == "" {
+		return c, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		ex, err := loadFile(file, s)
+		if err != nil {
+			return nil, fmt.Errorf("load exercise %s: %w", file, err)
+		}
+
+		if _, found := c.exercises[ex.Name]; found {
+			return nil, fmt.Errorf("%w: duplicate name %q in %s", ErrExerciseInvalid, ex.Name, file)
+		}
+		c.exercises[ex.Name] = ex
+	}
+
+	return c, nil
+}
+
+func (c *Catalog) Get(name string) (*Exercise, error) {
+	ex, found := c.exercises[name]
+	if !found {
+		return nil, ErrExerciseNotFound
+	}
+	return ex, nil
+}
+
+// returns exercises sorted by name
+func (c *Catalog) List() []*Exercise {
+	res := make([]*Exercise, 0, len(c.exercises))
+	for _, ex := range c.exercises {
+		res = append(res, ex)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+func loadFile(file string, s *core.Service) (*Exercise, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var ex Exercise
+	if err := yaml.Unmarshal(data, &ex); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrExerciseInvalid, err.Error())
+	}
+
+	if ex.Name == "" {
+		ex.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	if ex.InitialState != "" {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(file), ex.InitialState))
+		if err != nil {
+			return nil, err
+		}
+
+		var snap core.Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("%w: initial state: %s", ErrExerciseInvalid, err.Error())
+		}
+		if err := s.ValidateSnapshot(snap); err != nil {
+			return nil, fmt.Errorf("%w: initial state: %w", ErrExerciseInvalid, err)
+		}
+		ex.snapshot = &snap
+	}
+
+	if err := ex.validate(); err != nil {
+		return nil, err
+	}
+
+	return &ex, nil
+}
+
+// event kind is needed to grade exercise
+func (ex *Exercise) grades(kind string) bool {
+	switch kind {
+	case core.EventPuckSorted, core.EventOrderCompleted, core.EventReset, core.EventStateRestored:
+		return true
+	}
+	for _, f := range ex.Forbidden {
+		if f.Event == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (ex *Exercise) validate() error {
+	if ex.TimeLimit < 0 {
+		return fmt.Errorf("%w: negative time limit", ErrExerciseInvalid)
+	}
+
+	if len(ex.Goals) == 0 {
+		return fmt.Errorf("%w: no goals", ErrExerciseInvalid)
+	}
+
+	for _, goal := range ex.Goals {
+		switch goal.Kind {
+		case GoalSorted:
+		case GoalOrdersCompleted:
+			if goal.Count > len(ex.Orders) {
+				return fmt.Errorf("%w: goal %q wants %d orders, exercise has %d", ErrExerciseInvalid, goal.Kind, goal.Count, len(ex.Orders))
+			}
+		case GoalAllSorted:
+			if goal.Color == "" {
+				return fmt.Errorf("%w: goal %q needs color", ErrExerciseInvalid, goal.Kind)
+			}
+		default:
+			return fmt.Errorf("%w: unknown goal kind %q", ErrExerciseInvalid, goal.Kind)
+		}
+
+		if goal.Color != "" && !core.IsPuckColor(goal.Color) {
+			return fmt.Errorf("%w: goal %q has unknown color %q", ErrExerciseInvalid, goal.Kind, goal.Color)
+		}
+
+		// goals met at start would finish exercise at once
+		if goal.Count <= 0 {
+			return fmt.Errorf("%w: goal %q needs positive count", ErrExerciseInvalid, goal.Kind)
+		}
+	}
+
+	for _, order := range ex.Orders {
+		if len(order.Items) == 0 {
+			return fmt.Errorf("%w: order without items", ErrExerciseInvalid)
+		}
+		for _, item := range order.Items {
+			if !core.IsPuckColor(item.Color) {
+				return fmt.Errorf("%w: order item has unknown color %q", ErrExerciseInvalid, item.Color)
+			}
+			if item.Quantity <= 0 {
+				return fmt.Errorf("%w: order item needs positive quantity", ErrExerciseInvalid)
+			}
+		}
+	}
+
+	for _, f := range ex.Forbidden {
+		if f.Event == "" {
+			return fmt.Errorf("%w: forbidden entry without event kind", ErrExerciseInvalid)
+		}
+		if !core.IsEventKind(f.Event) {
+			return fmt.Errorf("%w: forbidden entry has unknown event kind %q", ErrExerciseInvalid, f.Event)
+		}
+		if f.Alarm != "" && !core.IsAlarmId(f.Alarm) {
+			return fmt.Errorf("%w: forbidden entry has unknown alarm %q", ErrExerciseInvalid, f.Alarm)
+		}
+	}
+
+	return nil
+}
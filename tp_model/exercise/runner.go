@@ -0,0 +1,427 @@
+package exercise
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+const (
+	// goals are checked that often, exercise finishes as soon as all are met
+	checkInterval = time.Second
+)
+
+type Criterion struct {
+	Name   string
+	Passed bool
+	Points int
+	Detail string
+}
+
+type Report struct {
+	Exercise   string
+	StartedAt  time.Time
+	FinishedAt *time.Time // nil while running
+	TimedOut   bool
+	Criteria   []Criterion
+	Score      int
+	MaxScore   int
+	Passed     bool // all criteria passed
+}
+
+type attempt struct {
+	exercise  *Exercise
+	startedAt time.Time
+	seq       uint64       // line events after it are not collected yet
+	events    []core.Event // attempt events grading looks at
+	report    *Report
+	stop      chan struct{}
+}
+
+// runs exercises on one line, one attempt at a time
+type Runner struct {
+	log     *slog.Logger
+	s       *core.Service
+	catalog *Catalog
+
+	mu      sync.Mutex
+	attempt *attempt
+}
+
+func NewRunner(log *slog.Logger, s *core.Service, catalog *Catalog) *Runner {
+	return &Runner{
+		log:     log,
+		s:       s,
+		catalog: catalog,
+	}
+}
+
+// resets line to exercise initial state and starts grading
+func (r *Runner) Start(name string) (Report, error) {
+	ex, err := r.catalog.Get(name)
+	if err != nil {
+		return Report{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.attempt != nil && r.attempt.report == nil {
+		return Report{}, ErrExerciseRunning
+	}
+
+	r.s.Reset(core.ResetOptions{Seed: ex.Seed})
+	if ex.snapshot != nil {
+		if err := r.s.Restore(*ex.snapshot); err != nil {
+			return Report{}, err
+		}
+	}
+
+	a := &attempt{
+		exercise:  ex,
+		startedAt: r.s.Now(),
+		seq:       r.s.LastEventSeq(),
+		stop:      make(chan struct{}),
+	}
+
+	for _, order := range ex.Orders {
+		items := make([]core.OrderItem, 0, len(order.Items))
+		for _, item := range order.Items {
+			items = append(items, core.OrderItem{Color: item.Color, IsDrilled: item.Drilled, Quantity: item.Quantity})
+		}
+		if _, err := r.s.CreateOrder(items); err != nil {
+			return Report{}, err
+		}
+	}
+
+	r.attempt = a
+
+	go r.watch(a)
+
+	r.log.Info("exercise started", "exercise", ex.Name)
+
+	return r.grade(a, false), nil
+}
+
+// finishes running attempt and returns final report
+func (r *Runner) Finish() (Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.attempt == nil {
+		return Report{}, ErrNoExercise
+	}
+
+	if r.attempt.report == nil {
+		r.finish(r.attempt, false)
+	}
+
+	return *r.attempt.report, nil
+}
+
+// returns final report or current grading of running attempt
+func (r *Runner) Report() (Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.attempt == nil {
+		return Report{}, ErrNoExercise
+	}
+
+	if r.attempt.report != nil {
+		return *r.attempt.report, nil
+	}
+
+	return r.grade(r.attempt, false), nil
+}
+
+// checks goals and time limit on simulation clock, so paused line does not run out of time
+func (r *Runner) watch(a *attempt) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-a.stop:
+		case <-r.s.Done():
+		}
+		cancel()
+	}()
+
+	for {
+		wait := checkInterval
+		if a.exercise.TimeLimit > 0 {
+			wait = min(wait, a.exercise.TimeLimit-r.s.Now().Sub(a.startedAt))
+		}
+		if err := r.s.Sleep(ctx, wait); err != nil {
+			return
+		}
+
+		r.mu.Lock()
+		if a.report == nil {
+			timedOut := a.exercise.TimeLimit > 0 && r.s.Now().Sub(a.startedAt) >= a.exercise.TimeLimit
+			r.collect(a)
+			if timedOut || restarts(a.events) > 0 || r.goalsMet(a) {
+				r.finish(a, timedOut)
+			}
+		}
+		stopped := a.report != nil
+		r.mu.Unlock()
+
+		if stopped {
+			return
+		}
+	}
+}
+
+// should be called with mu held
+func (r *Runner) finish(a *attempt, timedOut bool) {
+	report := r.grade(a, timedOut)
+	now := r.s.Now()
+	report.FinishedAt = &now
+	a.report = &report
+	close(a.stop)
+
+	r.log.Info("exercise finished", "exercise", a.exercise.Name, "score", report.Score, "maxScore", report.MaxScore, "passed", report.Passed)
+}
+
+// takes new line events into attempt, so grading does not depend on how long event log keeps them.
+// should be called with mu held
+func (r *Runner) collect(a *attempt) {
+	for _, e := range r.s.GetEvents(a.seq) {
+		a.seq = e.Seq
+		if a.exercise.grades(e.Kind) {
+			a.events = append(a.events, e)
+		}
+	}
+}
+
+// should be called with mu held
+func (r *Runner) goalsMet(a *attempt) bool {
+	snap := r.s.Snapshot()
+	for _, goal := range a.exercise.Goals {
+		if !gradeGoal(goal, a.events, snap).Passed {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Runner) grade(a *attempt, timedOut bool) Report {
+	report := Report{
+		Exercise:  a.exercise.Name,
+		StartedAt: a.startedAt,
+		TimedOut:  timedOut,
+		Criteria:  make([]Criterion, 0),
+	}
+
+	r.collect(a)
+
+	snap := r.s.Snapshot()
+	for _, goal := range a.exercise.Goals {
+		report.Criteria = append(report.Criteria, gradeGoal(goal, a.events, snap))
+	}
+
+	for _, f := range a.exercise.Forbidden {
+		report.Criteria = append(report.Criteria, gradeForbidden(f, a.events))
+	}
+
+	// line reset or restored during attempt could fake any goal, so attempt fails as a whole
+	restarted := restarts(a.events)
+	report.Criteria = append(report.Criteria, Criterion{
+		Name:   "no line reset or state restore",
+		Passed: restarted == 0,
+		Detail: fmt.Sprintf("happened %d times", restarted),
+	})
+
+	if a.exercise.TimeLimit > 0 {
+		report.Criteria = append(report.Criteria, Criterion{
+			Name:   fmt.Sprintf("finished within %s", a.exercise.TimeLimit),
+			Passed: !timedOut,
+			Points: 1,
+		})
+	}
+
+	report.Passed = true
+	for _, c := range report.Criteria {
+		report.MaxScore += c.Points
+		if c.Passed {
+			report.Score += c.Points
+		} else {
+			report.Passed = false
+		}
+	}
+	if restarted > 0 {
+		report.Score = 0
+	}
+
+	return report
+}
+
+// pucks sorted and orders completed are counted from attempt events, line snapshot gives pucks left on line
+func gradeGoal(goal Goal, events []core.Event, snap core.Snapshot) Criterion {
+	c := Criterion{
+		Name:   goal.Name,
+		Points: points(goal.Points),
+	}
+
+	switch goal.Kind {
+	case GoalSorted:
+		sorted := 0
+		for _, puck := range sortedPucks(events) {
+			if goal.matches(puck) {
+				sorted++
+			}
+		}
+
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("sort %d %s", goal.Count, goal.variant())
+		}
+		c.Passed = sorted >= goal.Count
+		c.Detail = fmt.Sprintf("sorted %d of %d", sorted, goal.Count)
+
+	case GoalAllSorted:
+		sorted, wrong, left := 0, 0, 0
+		for _, puck := range sortedPucks(events) {
+			if puck.Color != goal.Color {
+				continue
+			}
+			if goal.matches(puck) {
+				sorted++
+			} else {
+				wrong++
+			}
+		}
+		for _, puck := range linePucks(snap) {
+			if puck.Color == goal.Color {
+				left++
+			}
+		}
+
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("all %s sorted", goal.variant())
+		}
+		c.Passed = wrong == 0 && left == 0 && sorted >= goal.Count
+		c.Detail = fmt.Sprintf("sorted %d, wrong variant %d, left on line %d", sorted, wrong, left)
+
+	case GoalOrdersCompleted:
+		completed := 0
+		for _, e := range events {
+			if e.Kind == core.EventOrderCompleted {
+				completed++
+			}
+		}
+
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("complete %d orders", goal.Count)
+		}
+		c.Passed = completed >= goal.Count
+		c.Detail = fmt.Sprintf("completed %d of %d", completed, goal.Count)
+	}
+
+	return c
+}
+
+func gradeForbidden(f Forbidden, events []core.Event) Criterion {
+	c := Criterion{
+		Name:   f.Name,
+		Points: points(f.Points),
+	}
+
+	if c.Name == "" {
+		c.Name = "no " + f.Event
+		if f.Alarm != "" {
+			c.Name += " " + f.Alarm
+		}
+	}
+
+	count := 0
+	for _, e := range events {
+		if e.Kind != f.Event {
+			continue
+		}
+		if f.Alarm != "" && e.Data["id"] != f.Alarm {
+			continue
+		}
+		count++
+	}
+
+	c.Passed = count == 0
+	c.Detail = fmt.Sprintf("happened %d times", count)
+
+	return c
+}
+
+func (g Goal) matches(puck core.PuckState) bool {
+	if g.Color != "" && puck.Color != g.Color {
+		return false
+	}
+	if g.Drilled != nil && puck.IsDrilled != *g.Drilled {
+		return false
+	}
+	return true
+}
+
+// human readable puck variant like "drilled black pucks"
+func (g Goal) variant() string {
+	res := "pucks"
+	if g.Color != "" {
+		res = g.Color + " " + res
+	}
+
+	if g.Drilled != nil {
+		if *g.Drilled {
+			res = "drilled " + res
+		} else {
+			res = "undrilled " + res
+		}
+	}
+
+	return res
+}
+
+func sortedPucks(events []core.Event) []core.PuckState {
+	res := make([]core.PuckState, 0)
+	for _, e := range events {
+		if e.Kind != core.EventPuckSorted {
+			continue
+		}
+		color, _ := e.Data["color"].(string)
+		drilled, _ := e.Data["isDrilled"].(bool)
+		res = append(res, core.PuckState{Color: color, IsDrilled: drilled, IsPackaged: true})
+	}
+	return res
+}
+
+// line resets and state restores
+func restarts(events []core.Event) int {
+	count := 0
+	for _, e := range events {
+		if e.Kind == core.EventReset || e.Kind == core.EventStateRestored {
+			count++
+		}
+	}
+	return count
+}
+
+func linePucks(snap core.Snapshot) []core.PuckState {
+	res := make([]core.PuckState, 0)
+	slots := []*core.PuckState{snap.Gripper.Puck, snap.Start.Puck, snap.Packaging.Puck, snap.Sorting.Puck}
+	slots = append(slots, snap.Carousel.Slots...)
+	for _, puck := range slots {
+		if puck != nil {
+			res = append(res, *puck)
+		}
+	}
+	return res
+}
+
+func points(p int) int {
+	if p == 0 {
+		return 1
+	}
+	return p
+}
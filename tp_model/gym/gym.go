@@ -0,0 +1,357 @@
+package gym
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+var (
+	ErrUnknownAction = errors.New("unknown action")
+	ErrNotReset      = errors.New("environment should be reset first")
+	ErrEpisodeDone   = errors.New("episode is done, reset environment")
+	ErrConfigInvalid = errors.New("invalid environment config")
+)
+
+const (
+	defaultTicksPerStep = 10 // 100ms
+	defaultMaxSteps     = 20000
+	maxTicksPerStep     = 6000    // one minute of simulated time, longer step blocks request for too long
+	maxMaxSteps         = 1000000 // episode of 1000000 steps is more than a day of simulated time
+	tick                = 10 * time.Millisecond
+)
+
+type Action int
+
+const (
+	ActionNoop Action = iota
+	ActionLeft
+	ActionRight
+	ActionUp
+	ActionDown
+	ActionStop
+	ActionOpen
+	ActionClose
+	ActionRotate
+	ActionDrill
+	ActionPack
+	ActionSort
+	ActionFeed
+	ActionEmptyBins
+)
+
+// action names in order of their numbers
+var ActionNames = []string{"noop", "left", "right", "up", "down", "stop", "open", "close", "rotate", "drill", "pack", "sort", "feed", "empty_bins"}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(ActionNames) {
+		return "unknown"
+	}
+	return ActionNames[a]
+}
+
+func ParseAction(name string) (Action, error) {
+	for i, n := range ActionNames {
+		if n == name {
+			return Action(i), nil
+		}
+	}
+	return 0, ErrUnknownAction
+}
+
+// observation vector layout, same order as ObservationLabels
+var ObservationLabels = observationLabels()
+
+var gripperSensors = []string{"ns:1, i:1", "ns:1, i:2", "ns:1, i:3", "ns:1, i:4"}
+
+type Rewards struct {
+	Sorted float64 // per sorted puck
+	Error  float64 // per rejected action
+	Alarm  float64 // per raised alarm
+	Step   float64 // every step, time cost
+}
+
+var DefaultRewards = Rewards{
+	Sorted: 1,
+	Error:  -0.1,
+	Alarm:  -1,
+	Step:   -0.001,
+}
+
+type Config struct {
+	TicksPerStep int      // simulation ticks done by one step, up to maxTicksPerStep
+	MaxSteps     int      // episode is truncated after that, up to maxMaxSteps
+	Rewards      *Rewards // DefaultRewards if nil
+}
+
+type Observation struct {
+	Vector []float64
+	Time   time.Duration // simulated time since reset
+}
+
+type StepResult struct {
+	Observation Observation
+	Reward      float64
+	Done        bool   // terminated or truncated
+	Truncated   bool   // step limit reached
+	Error       string // why action was rejected, empty if it was done
+	Sorted      int    // pucks sorted since reset
+}
+
+// gym like environment over line simulated on virtual clock, every reset starts new line
+type Env struct {
+	log *slog.Logger
+	cfg Config
+
+	mu      sync.Mutex
+	s       *core.Service
+	start   time.Time
+	steps   int
+	sorted  int
+	lastSeq uint64
+	done    bool
+}
+
+func NewEnv(log *slog.Logger, cfg Config) *Env {
+	if cfg.TicksPerStep <= 0 {
+		cfg.TicksPerStep = defaultTicksPerStep
+	}
+	if cfg.MaxSteps <= 0 {
+		cfg.MaxSteps = defaultMaxSteps
+	}
+	if cfg.Rewards == nil {
+		cfg.Rewards = &DefaultRewards
+	}
+
+	return &Env{
+		log: log,
+		cfg: cfg,
+	}
+}
+
+// zero values are replaced by defaults, so only upper bounds and signs are checked
+func validateConfig(cfg Config) error {
+	if cfg.TicksPerStep < 0 || cfg.TicksPerStep > maxTicksPerStep {
+		return fmt.Errorf("%w: ticks per step should be from 0 to %d", ErrConfigInvalid, maxTicksPerStep)
+	}
+	if cfg.MaxSteps < 0 || cfg.MaxSteps > maxMaxSteps {
+		return fmt.Errorf("%w: max steps should be from 0 to %d", ErrConfigInvalid, maxMaxSteps)
+	}
+	return nil
+}
+
+func (e *Env) Config() Config {
+	return e.cfg
+}
+
+// starts new episode on fresh line, same seed gives same episode for same actions
+func (e *Env) Reset(seed int64) Observation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.s != nil {
+		e.s.Close()
+	}
+
+	// line logs would flood training output
+	e.s = core.NewService(slog.New(slog.NewTextHandler(io.Discard, nil)), core.Options{FastMode: true})
+	e.s.Reset(core.ResetOptions{Seed: &seed})
+
+	e.start = e.s.Now()
+	e.steps = 0
+	e.sorted = 0
+	e.lastSeq = e.s.LastEventSeq()
+	e.done = false
+
+	e.log.Debug("episode reset", "seed", seed)
+
+	return e.observe()
+}
+
+// simulates one step, ctx cancels it in the middle, then episode goes on from where it stopped
+func (e *Env) Step(ctx context.Context, action Action) (StepResult, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.s == nil {
+		return StepResult{}, ErrNotReset
+	}
+	if e.done {
+		return StepResult{}, ErrEpisodeDone
+	}
+	if action < 0 || int(action) >= len(ActionNames) {
+		return StepResult{}, ErrUnknownAction
+	}
+
+	res := StepResult{
+		Reward: e.cfg.Rewards.Step,
+	}
+
+	if err := e.apply(ctx, action); err != nil {
+		res.Error = err.Error()
+		res.Reward += e.cfg.Rewards.Error
+	}
+
+	err := e.s.Sleep(ctx, time.Duration(e.cfg.TicksPerStep)*tick)
+	if action == ActionStop {
+		// stop takes effect on next tick, gripper can be moved again after it
+		e.s.EnableMovingGripper()
+	}
+	if err != nil {
+		return StepResult{}, err
+	}
+	e.steps++
+
+	sorted := 0
+	for _, count := range e.s.GetStatistics().Produced {
+		sorted += count
+	}
+	res.Reward += float64(sorted-e.sorted) * e.cfg.Rewards.Sorted
+	e.sorted = sorted
+	res.Sorted = sorted
+
+	terminated := false
+	for _, event := range e.s.GetEvents(e.lastSeq) {
+		e.lastSeq = event.Seq
+		if event.Kind != core.EventAlarmRaised {
+			continue
+		}
+		res.Reward += e.cfg.Rewards.Alarm
+		if event.Data["severity"] == core.AlarmSeverityCritical {
+			terminated = true
+		}
+	}
+
+	res.Truncated = e.steps >= e.cfg.MaxSteps
+	res.Done = terminated || res.Truncated
+	e.done = res.Done
+	res.Observation = e.observe()
+
+	return res, nil
+}
+
+func (e *Env) Observe() (Observation, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.s == nil {
+		return Observation{}, ErrNotReset
+	}
+
+	return e.observe(), nil
+}
+
+func (e *Env) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.s != nil {
+		e.s.Close()
+		e.s = nil
+	}
+}
+
+func (e *Env) apply(ctx context.Context, action Action) error {
+	switch action {
+	case ActionLeft:
+		return e.s.MoveGripperLeft()
+	case ActionRight:
+		return e.s.MoveGripperRight()
+	case ActionUp:
+		return e.s.MoveGripperUp()
+	case ActionDown:
+		return e.s.MoveGripperDown()
+	case ActionStop:
+		e.s.StopGripper()
+	case ActionOpen:
+		return e.s.OpenGripper()
+	case ActionClose:
+		return e.s.CloseGripper()
+	case ActionRotate:
+		return e.s.RotateCarousel(ctx)
+	case ActionDrill:
+		return e.s.DrillPuck()
+	case ActionPack:
+		return e.s.PackagePuck(ctx)
+	case ActionSort:
+		return e.s.SortPuck(ctx)
+	case ActionFeed:
+		return e.s.PlaceNewStartPuck()
+	case ActionEmptyBins:
+		e.s.EmptySortingBins()
+	}
+	return nil
+}
+
+func (e *Env) observe() Observation {
+	snap := e.s.Snapshot()
+
+	v := make([]float64, 0, len(ObservationLabels))
+	v = append(v,
+		snap.Gripper.HorizontalPosition,
+		snap.Gripper.VerticalPosition,
+		bit(snap.Gripper.IsOpen),
+		bit(e.s.Gripper.IsMovingHorizontaly),
+		bit(e.s.Gripper.IsMovingVerticly),
+	)
+
+	for _, id := range gripperSensors {
+		value, _ := e.s.GetSensorValue(id)
+		v = append(v, bit(value))
+	}
+
+	slots := []*core.PuckState{snap.Gripper.Puck, snap.Start.Puck}
+	slots = append(slots, snap.Carousel.Slots...)
+	slots = append(slots, snap.Packaging.Puck, snap.Sorting.Puck)
+	for _, puck := range slots {
+		if puck == nil {
+			v = append(v, 0, 0, 0)
+			continue
+		}
+		v = append(v, 1, bit(puck.IsDrilled), bit(puck.IsPackaged))
+	}
+
+	return Observation{
+		Vector: v,
+		Time:   e.s.Now().Sub(e.start),
+	}
+}
+
+func observationLabels() []string {
+	labels := []string{
+		"gripper_x_m",
+		"gripper_y_m",
+		"gripper_open",
+		"gripper_moving_horizontally",
+		"gripper_moving_vertically",
+		"sensor_carousel",
+		"sensor_start",
+		"sensor_packaging",
+		"sensor_sorting",
+	}
+
+	slots := []string{"gripper", "start"}
+	for _, i := range []string{"0", "1", "2", "3", "4", "5"} {
+		slots = append(slots, "carousel_"+i)
+	}
+	slots = append(slots, "packaging", "sorting")
+
+	for _, slot := range slots {
+		labels = append(labels, slot+"_occupied", slot+"_drilled", slot+"_packaged")
+	}
+
+	return labels
+}
+
+func bit(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package gym
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrEnvNotFound = errors.New("environment not found")
+	ErrTooManyEnvs = errors.New("too many environments")
+)
+
+const (
+	cleanupInterval = time.Minute
+)
+
+type Entry struct {
+	Id        string
+	CreatedAt time.Time
+	Env       *Env
+
+	mu       sync.Mutex
+	lastUsed time.Time
+}
+
+func (e *Entry) touch() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastUsed = time.Now()
+}
+
+func (e *Entry) LastUsed() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lastUsed
+}
+
+// environments created over http, each owns its own line
+type Registry struct {
+	log         *slog.Logger
+	maxEnvs     int
+	idleTimeout time.Duration
+
+	mu   sync.Mutex
+	envs map[string]*Entry // id -> env
+}
+
+func NewRegistry(log *slog.Logger, maxEnvs int, idleTimeout time.Duration) *Registry {
+	return &Registry{
+		log:         log,
+		maxEnvs:     maxEnvs,
+		idleTimeout: idleTimeout,
+		envs:        make(map[string]*Entry),
+	}
+}
+
+func (r *Registry) Create(cfg Config) (*Entry, error) {
+	if err := validateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.envs) >= r.maxEnvs {
+		return nil, ErrTooManyEnvs
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(b)
+
+	now := time.Now()
+	entry := &Entry{
+		Id:        id,
+		CreatedAt: now,
+		Env:       NewEnv(r.log.With("env", id), cfg),
+		lastUsed:  now,
+	}
+	r.envs[id] = entry
+
+	r.log.Info("gym environment created", "env", id)
+
+	return entry, nil
+}
+
+// returns environment and marks it as used
+func (r *Registry) Get(id string) (*Entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, found := r.envs[id]
+	if !found {
+		return nil, ErrEnvNotFound
+	}
+
+	entry.touch()
+
+	return entry, nil
+}
+
+// returns environments sorted by creation time
+func (r *Registry) List() []*Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]*Entry, 0, len(r.envs))
+	for _, entry := range r.envs {
+		res = append(res, entry)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+
+	return res
+}
+
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, found := r.envs[id]
+	if !found {
+		return ErrEnvNotFound
+	}
+
+	r.remove(entry)
+
+	return nil
+}
+
+// removes environments not used longer than idle timeout, blocks until ctx is done
+func (r *Registry) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		for _, entry := range r.envs {
+			if time.Since(entry.LastUsed()) > r.idleTimeout {
+				r.remove(entry)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *Registry) remove(entry *Entry) {
+	delete(r.envs, entry.Id)
+	entry.Env.Close()
+	r.log.Info("gym environment removed", "env", entry.Id)
+}
@@ -0,0 +1,235 @@
+package lines
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+var (
+	ErrLineNotFound = errors.New("line not found")
+	ErrTooManyLines = errors.New("too many lines")
+)
+
+const (
+	cleanupInterval = time.Minute
+)
+
+// per line configuration, everything is optional
+type LineConfig struct {
+	InitialState *core.Snapshot
+	Seed         *int64
+}
+
+type Line struct {
+	Id        string
+	CreatedAt time.Time
+	Service   *core.Service
+	Handler   http.Handler
+
+	mu          sync.Mutex
+	lastUsed    time.Time
+	requests    int       // requests being served, event streams stay open long
+	leaseExpiry time.Time // of control lease at last check, heartbeats of controller move it
+}
+
+func (l *Line) touch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastUsed = time.Now()
+}
+
+func (l *Line) LastUsed() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastUsed
+}
+
+// serves line api, line is not removed while request is served
+func (l *Line) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	l.requests++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.requests--
+		l.lastUsed = time.Now()
+	}()
+
+	l.Handler.ServeHTTP(w, r)
+}
+
+// line is idle when it serves no request and nobody used it or drove it for timeout,
+// auto and plc controllers drive line without requests but keep control lease alive
+func (l *Line) idle(timeout time.Duration) bool {
+	lease, held := l.Service.GetControl()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if held && !lease.ExpiresAt.Equal(l.leaseExpiry) {
+		l.leaseExpiry = lease.ExpiresAt
+		l.lastUsed = time.Now()
+	}
+
+	return l.requests == 0 && time.Since(l.lastUsed) > timeout
+}
+
+// makes http handler serving line api, paths are relative to line root
+type HandlerFactory func(log *slog.Logger, s *core.Service) http.Handler
+
+// isolated simulated lines, one per client
+type Registry struct {
+	log         *slog.Logger
+	opts        core.Options
+	newHandler  HandlerFactory
+	idleTimeout time.Duration
+	maxLines    int
+
+	mu    sync.Mutex
+	lines map[string]*Line // id -> line
+}
+
+func NewRegistry(log *slog.Logger, opts core.Options, newHandler HandlerFactory, idleTimeout time.Duration, maxLines int) *Registry {
+	return &Registry{
+		log:         log,
+		opts:        opts,
+		newHandler:  newHandler,
+		idleTimeout: idleTimeout,
+		maxLines:    maxLines,
+		lines:       make(map[string]*Line),
+	}
+}
+
+func (r *Registry) Create(cfg LineConfig) (*Line, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.lines) >= r.maxLines {
+		return nil, ErrTooManyLines
+	}
+
+	id, err := newLineId()
+	if err != nil {
+		return nil, err
+	}
+
+	log := r.log.With("line", id)
+	service := core.NewService(log, r.opts)
+
+	if cfg.InitialState != nil {
+		if err := service.SetInitialState(*cfg.InitialState); err != nil {
+			service.Close()
+			return nil, err
+		}
+	}
+	if cfg.InitialState != nil || cfg.Seed != nil {
+		service.Reset(core.ResetOptions{Seed: cfg.Seed})
+	}
+
+	now := time.Now()
+	line := &Line{
+		Id:        id,
+		CreatedAt: now,
+		Service:   service,
+		Handler:   r.newHandler(log, service),
+		lastUsed:  now,
+	}
+	r.lines[id] = line
+
+	r.log.Info("line created", "line", id)
+
+	return line, nil
+}
+
+// returns line and marks it as used
+func (r *Registry) Get(id string) (*Line, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line, found := r.lines[id]
+	if !found {
+		return nil, ErrLineNotFound
+	}
+
+	line.touch()
+
+	return line, nil
+}
+
+// returns lines sorted by creation time
+func (r *Registry) List() []*Line {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]*Line, 0, len(r.lines))
+	for _, line := range r.lines {
+		res = append(res, line)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+
+	return res
+}
+
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line, found := r.lines[id]
+	if !found {
+		return ErrLineNotFound
+	}
+
+	r.remove(line)
+
+	return nil
+}
+
+// removes idle lines, blocks until ctx is done
+func (r *Registry) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		for _, line := range r.lines {
+			if line.idle(r.idleTimeout) {
+				r.remove(line)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *Registry) remove(line *Line) {
+	delete(r.lines, line.Id)
+	line.Service.Close()
+	r.log.Info("line removed", "line", line.Id)
+}
+
+func newLineId() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/Razzle131/line316/tp_model/adapters/rest"
+	"github.com/Razzle131/line316/tp_model/auto"
 	"github.com/Razzle131/line316/tp_model/config"
+	_ "github.com/Razzle131/line316/tp_model/controllers"
 	"github.com/Razzle131/line316/tp_model/core"
+	"github.com/Razzle131/line316/tp_model/exercise"
+	"github.com/Razzle131/line316/tp_model/gym"
+	"github.com/Razzle131/line316/tp_model/lines"
+	"github.com/Razzle131/line316/tp_model/plc"
+	"github.com/Razzle131/line316/tp_model/st"
 )
 
 // данная программа написано криво и гексагональной архитектуре не соответствует, просьба не смотреть), модель учебная, переписывать ее полностью уже поздно
@@ -26,64 +36,104 @@ func WithoutCORS(f http.HandlerFunc) http.HandlerFunc {
 
 func main() {
 	var configPath string
+	var autoStart bool
+	var fastPucks int
+	var fastSeed int64
+	var fastPLC string
+	var fastTime time.Duration
 	flag.StringVar(&configPath, "config", "config.yaml", "server configuration file")
+	flag.BoolVar(&autoStart, "auto", false, "run built-in controller on default line")
+	flag.IntVar(&fastPucks, "fast", 0, "headless discrete-event run of built-in controller for that many pucks, no server is started")
+	flag.Int64Var(&fastSeed, "fast-seed", 1, "puck supply seed of fast run")
+	flag.StringVar(&fastPLC, "fast-plc", "", "headless discrete-event run of plc controller compiled into binary instead of built-in controller")
+	flag.DurationVar(&fastTime, "fast-time", 10*time.Minute, "simulated time of plc fast run")
 	flag.Parse()
 
 	cfg := config.MustLoad(configPath)
 
 	log := mustMakeLogger(cfg.LogLevel)
 
-	if err := run(cfg, log); err != nil {
+	if fastPucks > 0 || fastPLC != "" {
+		drive := func(ctx context.Context, s *core.Service) error {
+			return auto.New(log, s).Run(ctx, fastPucks)
+		}
+		if fastPLC != "" {
+			ctrl, err := plc.New(fastPLC)
+			if err != nil {
+				log.Error("fast run", "controller", fastPLC, "error", err)
+				os.Exit(1)
+			}
+			drive = func(ctx context.Context, s *core.Service) error {
+				return plc.NewRuntime(log, s).Run(ctx, fastPLC, ctrl, fastTime)
+			}
+		}
+
+		if err := runFast(cfg, log, fastSeed, drive); err != nil {
+			log.Error("fast run", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(cfg, log, autoStart); err != nil {
 		log.Error("run func", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run(cfg config.Config, log *slog.Logger) error {
+func run(cfg config.Config, log *slog.Logger, autoStart bool) error {
 	log.Info("starting server")
 	log.Debug("debug messages are enabled")
 
-	service := core.NewService(log)
-
-	mux := http.NewServeMux()
-
-	mux.Handle("GET /tp/ping", rest.NewPingHandler())
+	opts := lineOptions(cfg)
+	service := core.NewService(log, opts)
 
-	mux.Handle("POST /tp/puck", rest.NewStartPuck(log, service))
+	if cfg.StateFile != "" {
+		if err := loadStateFile(service, cfg.StateFile); err != nil {
+			return err
+		}
+		log.Info("loaded initial state", "file", cfg.StateFile)
+	}
 
-	mux.Handle("GET /tp/sensor/{sensor_id}", rest.NewSensorHandler(log, service))
+	catalog, err := exercise.LoadDir(cfg.ExercisesDir, service)
+	if err != nil {
+		return err
+	}
+	log.Info("loaded exercises", "dir", cfg.ExercisesDir, "count", len(catalog.List()))
 
-	// gripper
-	mux.Handle("POST /tp/gripper/left", rest.NewGripperLeftHandler(log, service))
-	mux.Handle("POST /tp/gripper/right", rest.NewGripperRightHandler(log, service))
-	mux.Handle("POST /tp/gripper/up", rest.NewGripperUpHandler(log, service))
-	mux.Handle("POST /tp/gripper/down", rest.NewGripperDownHandler(log, service))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	mux.Handle("POST /tp/gripper/open", rest.NewGripperOpenHandler(log, service))
-	mux.Handle("POST /tp/gripper/close", rest.NewGripperCloseHandler(log, service))
+	// default line is served from root, other lines are created on demand
+	controller := auto.New(log, service)
+	mux := newLineMux(log, service, controller, exercise.NewRunner(log, service, catalog), catalog, cfg.TeacherKey)
 
-	mux.Handle("POST /tp/gripper/stop", rest.NewGripperStopHandler(log, service))
+	if autoStart {
+		if err := controller.Start(); err != nil {
+			return err
+		}
+	}
 
-	// carousel
-	mux.Handle("POST /tp/carousel/rotate", rest.NewCarouselRotateHandler(log, service))
-	mux.Handle("POST /tp/carousel/inspect", rest.NewCarouselInspectHandler(log, service))
-	mux.Handle("POST /tp/carousel/drill", rest.NewCarouselDrillHandler(log, service))
+	registry := lines.NewRegistry(log, opts, func(log *slog.Logger, s *core.Service) http.Handler {
+		return newLineMux(log, s, auto.New(log, s), exercise.NewRunner(log, s, catalog), catalog, cfg.TeacherKey)
+	}, cfg.LineIdleTimeout, cfg.MaxLines)
+	go registry.RunCleanup(ctx)
 
-	// packaging
-	mux.Handle("POST /tp/packaging/pack", rest.NewPackagingHandler(log, service))
+	mux.Handle("POST /lines", rest.NewCreateLineHandler(log, registry))
+	mux.Handle("GET /lines", rest.NewListLinesHandler(log, registry))
+	mux.Handle("DELETE /lines/{line_id}", rest.NewDeleteLineHandler(log, registry))
+	mux.Handle("/lines/{line_id}/", rest.NewLineHandler(log, registry))
 
-	// sorting
-	mux.Handle("POST /tp/sorting/sort", rest.NewSortingHandler(log, service))
-
-	// visualisation
-	mux.Handle("GET /vis/start", WithoutCORS(rest.NewStartHandler(service)))
-	mux.Handle("GET /vis/gripper", WithoutCORS(rest.NewGripperHandler(service)))
-	mux.Handle("GET /vis/carousel", WithoutCORS(rest.NewCarouselHandler(service)))
-	mux.Handle("GET /vis/packaging", WithoutCORS(rest.NewPackagingLineHandler(service)))
-	mux.Handle("GET /vis/sorting", WithoutCORS(rest.NewSortingLineHandler(service)))
-
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
+	// gym environments run own lines on virtual clock
+	envs := gym.NewRegistry(log, cfg.MaxGymEnvs, cfg.GymIdleTimeout)
+	go envs.RunCleanup(ctx)
+	mux.Handle("GET /gym", rest.NewGymSpaceHandler(log))
+	mux.Handle("POST /gym/envs", rest.NewCreateEnvHandler(log, envs))
+	mux.Handle("GET /gym/envs", rest.NewListEnvsHandler(log, envs))
+	mux.Handle("DELETE /gym/envs/{env_id}", rest.NewDeleteEnvHandler(log, envs))
+	mux.Handle("POST /gym/envs/{env_id}/reset", rest.NewResetEnvHandler(log, envs))
+	mux.Handle("POST /gym/envs/{env_id}/step", rest.NewStepEnvHandler(log, envs))
+	mux.Handle("GET /gym/envs/{env_id}/observe", rest.NewObserveEnvHandler(log, envs))
 
 	server := http.Server{
 		Addr:        cfg.Address,
@@ -111,6 +161,238 @@ func run(cfg config.Config, log *slog.Logger) error {
 	return nil
 }
 
+// routes of one line, relative to line root
+func newLineMux(log *slog.Logger, service *core.Service, controller *auto.Controller, runner *exercise.Runner, catalog *exercise.Catalog, teacherKey string) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	commands := rest.NewCommandMetrics()
+
+	// commands need line control if someone holds it and feed watchdog, reads are always allowed
+	command := func(h http.Handler) http.Handler {
+		return rest.CountCommands(commands, rest.RequireControl(log, service, rest.FeedWatchdog(service, h)))
+	}
+
+	mux.Handle("GET /metrics", rest.NewMetricsHandler(service, commands))
+
+	// analytics
+	mux.Handle("GET /tp/analytics", rest.NewAnalyticsHandler(log, service))
+	mux.Handle("GET /tp/analytics/pucks.csv", rest.NewAnalyticsPucksCSVHandler(log, service))
+	mux.Handle("GET /tp/analytics/stations.csv", rest.NewAnalyticsStationsCSVHandler(log, service))
+	mux.Handle("POST /tp/analytics/start", command(rest.NewAnalyticsStartHandler(log, service)))
+	mux.Handle("POST /tp/analytics/stop", command(rest.NewAnalyticsStopHandler(log, service)))
+
+	// signal trace sampled every tick, like logic analyser
+	mux.Handle("GET /tp/trace", rest.NewTraceStatusHandler(log, service))
+	mux.Handle("POST /tp/trace/start", command(rest.NewTraceStartHandler(log, service)))
+	mux.Handle("POST /tp/trace/stop", command(rest.NewTraceStopHandler(log, service)))
+	mux.Handle("GET /tp/trace/trace.vcd", rest.NewTraceVCDHandler(log, service))
+	mux.Handle("GET /tp/trace/trace.csv", rest.NewTraceCSVHandler(log, service))
+
+	// breakpoints pause simulation clock, paused line can be run tick by tick
+	mux.Handle("GET /tp/breakpoints", rest.NewBreakpointsHandler(log, service))
+	mux.Handle("POST /tp/breakpoints", command(rest.NewCreateBreakpointHandler(log, service)))
+	mux.Handle("DELETE /tp/breakpoints/{breakpoint_id}", command(rest.NewDeleteBreakpointHandler(log, service)))
+	mux.Handle("GET /tp/simulation", rest.NewSimulationStatusHandler(log, service))
+	mux.Handle("POST /tp/simulation/pause", command(rest.NewSimulationPauseHandler(log, service)))
+	mux.Handle("POST /tp/simulation/resume", command(rest.NewSimulationResumeHandler(log, service)))
+	mux.Handle("POST /tp/simulation/step", command(rest.NewSimulationStepHandler(log, service)))
+
+	// production orders
+	mux.Handle("GET /tp/orders", rest.NewOrdersHandler(log, service))
+	mux.Handle("POST /tp/orders", command(rest.NewCreateOrderHandler(log, service)))
+	mux.Handle("GET /tp/orders/next", rest.NewNextOrderHandler(log, service))
+	mux.Handle("GET /tp/orders/{order_id}", rest.NewOrderHandler(log, service))
+	mux.Handle("DELETE /tp/orders/{order_id}", command(rest.NewCancelOrderHandler(log, service)))
+
+	// built-in reference controller, it holds line control while running, so stop is not a command:
+	// nobody else can own the line then and stopping should always be possible
+	mux.Handle("GET /tp/auto", rest.NewAutoStatusHandler(log, controller))
+	mux.Handle("POST /tp/auto/start", command(rest.NewAutoStartHandler(log, controller)))
+	mux.Handle("POST /tp/auto/stop", rest.NewAutoStopHandler(log, controller))
+
+	// command sequence planner, planning only reads line state, plan is executed by built-in controller
+	mux.Handle("POST /tp/plan", rest.NewPlanHandler(log, service))
+	mux.Handle("POST /tp/plan/execute", command(rest.NewPlanExecuteHandler(log, service, controller)))
+
+	// in-process controllers in plc scan cycle, they hold line control while running, stop is not
+	// a command for the same reason as auto stop
+	runtime := plc.NewRuntime(log, service)
+	mux.Handle("GET /tp/plc", rest.NewPLCStatusHandler(log, runtime))
+	mux.Handle("GET /tp/plc/controllers", rest.NewPLCControllersHandler(log))
+	mux.Handle("POST /tp/plc/{controller_name}/start", command(rest.NewPLCStartHandler(log, runtime)))
+	mux.Handle("POST /tp/plc/stop", rest.NewPLCStopHandler(log, runtime))
+
+	// structured text program uploaded by student, it runs in the same plc runtime
+	programs := st.NewStore()
+	mux.Handle("PUT /tp/st/program", command(rest.NewSTUploadHandler(log, programs, runtime)))
+	mux.Handle("GET /tp/st/program", rest.NewSTProgramHandler(log, programs))
+	mux.Handle("GET /tp/st/variables", rest.NewSTVariablesHandler(log, programs, runtime))
+	mux.Handle("POST /tp/st/start", command(rest.NewSTStartHandler(log, programs, runtime)))
+
+	// graded exercises, starting one resets the line
+	mux.Handle("GET /tp/exercises", rest.NewExercisesHandler(log, catalog))
+	mux.Handle("GET /tp/exercise", rest.NewExerciseReportHandler(log, runner))
+	mux.Handle("POST /tp/exercise/{exercise_name}/start", command(rest.NewExerciseStartHandler(log, runner)))
+	mux.Handle("POST /tp/exercise/finish", command(rest.NewExerciseFinishHandler(log, runner)))
+
+	mux.Handle("GET /tp/ping", rest.NewPingHandler())
+
+	mux.Handle("POST /tp/puck", command(rest.NewStartPuck(log, service)))
+
+	mux.Handle("GET /tp/sensor/{sensor_id}", rest.NewSensorHandler(log, service))
+	mux.Handle("GET /tp/sensor/{sensor_id}/characteristics", rest.NewSensorCharacteristicsHandler(log, service))
+	mux.Handle("PUT /tp/sensor/{sensor_id}/characteristics", command(rest.NewSetSensorCharacteristicsHandler(log, service)))
+	mux.Handle("GET /tp/encoder/{encoder_id}", rest.NewEncoderHandler(log, service))
+	mux.Handle("GET /tp/encoder/{encoder_id}/characteristics", rest.NewEncoderCharacteristicsHandler(log, service))
+	mux.Handle("PUT /tp/encoder/{encoder_id}/characteristics", command(rest.NewSetEncoderCharacteristicsHandler(log, service)))
+	mux.Handle("GET /tp/wait", rest.HoldWatchdog(service, rest.NewWaitHandler(log, service)))
+
+	// control, lease routes check owner and token themselves
+	mux.Handle("GET /tp/control", rest.NewControlHandler(service))
+	mux.Handle("POST /tp/control/acquire", rest.NewControlAcquireHandler(log, service))
+	mux.Handle("POST /tp/control/heartbeat", rest.FeedWatchdog(service, rest.NewControlHeartbeatHandler(log, service)))
+	mux.Handle("POST /tp/control/release", rest.NewControlReleaseHandler(log, service))
+	mux.Handle("POST /tp/control/seize", rest.NewControlSeizeHandler(log, service, teacherKey))
+
+	// watchdog
+	mux.Handle("GET /tp/watchdog", rest.NewWatchdogHandler(service))
+	mux.Handle("POST /tp/watchdog/heartbeat", command(rest.NewWatchdogHeartbeatHandler(log, service)))
+
+	// state
+	mux.Handle("GET /tp/state", rest.NewGetStateHandler(log, service))
+	mux.Handle("PUT /tp/state", command(rest.NewPutStateHandler(log, service)))
+	mux.Handle("GET /tp/history", rest.NewHistoryHandler(log, service))
+	mux.Handle("POST /tp/reset", command(rest.NewResetHandler(log, service)))
+
+	// actuators
+	mux.Handle("GET /tp/actuator/{actuator_id}", rest.NewActuatorHandler(log, service))
+	mux.Handle("POST /tp/actuator/{actuator_id}/activate", command(rest.NewActuatorActivateHandler(log, service)))
+	mux.Handle("POST /tp/actuator/{actuator_id}/deactivate", command(rest.NewActuatorDeactivateHandler(log, service)))
+	mux.Handle("GET /tp/lights", rest.NewLightsHandler(service))
+
+	mux.Handle("GET /tp/events", rest.NewEventsHandler(log, service))
+	mux.Handle("GET /tp/events/stream", rest.NewEventsStreamHandler(log, service))
+
+	// alarms
+	mux.Handle("GET /tp/alarms", rest.NewAlarmsHandler(service))
+	mux.Handle("POST /tp/alarms/ack", command(rest.NewAlarmAcknowledgeAllHandler(log, service)))
+	mux.Handle("POST /tp/alarms/{alarm_id}/ack", command(rest.NewAlarmAcknowledgeHandler(log, service)))
+
+	// gripper
+	mux.Handle("POST /tp/gripper/left", command(rest.NewGripperLeftHandler(log, service)))
+	mux.Handle("POST /tp/gripper/right", command(rest.NewGripperRightHandler(log, service)))
+	mux.Handle("POST /tp/gripper/up", command(rest.NewGripperUpHandler(log, service)))
+	mux.Handle("POST /tp/gripper/down", command(rest.NewGripperDownHandler(log, service)))
+
+	mux.Handle("POST /tp/gripper/open", command(rest.NewGripperOpenHandler(log, service)))
+	mux.Handle("POST /tp/gripper/close", command(rest.NewGripperCloseHandler(log, service)))
+
+	mux.Handle("POST /tp/gripper/stop", command(rest.NewGripperStopHandler(log, service)))
+	mux.Handle("GET /tp/gripper/motion", rest.NewMotionProfileHandler(log, service))
+	mux.Handle("PUT /tp/gripper/motion", command(rest.NewSetMotionProfileHandler(log, service)))
+
+	// carousel
+	mux.Handle("POST /tp/carousel/rotate", command(rest.NewCarouselRotateHandler(log, service)))
+	mux.Handle("POST /tp/carousel/inspect", command(rest.NewCarouselInspectHandler(log, service)))
+	mux.Handle("POST /tp/carousel/drill", command(rest.NewCarouselDrillHandler(log, service)))
+
+	// packaging
+	mux.Handle("POST /tp/packaging/pack", command(rest.NewPackagingHandler(log, service)))
+
+	// sorting
+	mux.Handle("POST /tp/sorting/sort", command(rest.NewSortingHandler(log, service)))
+	mux.Handle("POST /tp/sorting/empty", command(rest.NewSortingEmptyBinsHandler(log, service)))
+
+	// visualisation
+	mux.Handle("GET /vis/start", WithoutCORS(rest.NewStartHandler(service)))
+	mux.Handle("GET /vis/gripper", WithoutCORS(rest.NewGripperHandler(service)))
+	mux.Handle("GET /vis/carousel", WithoutCORS(rest.NewCarouselHandler(service)))
+	mux.Handle("GET /vis/packaging", WithoutCORS(rest.NewPackagingLineHandler(service)))
+	mux.Handle("GET /vis/sorting", WithoutCORS(rest.NewSortingLineHandler(service)))
+	mux.Handle("GET /vis/lights", WithoutCORS(rest.NewLightsHandler(service)))
+	mux.Handle("GET /vis/alarms", WithoutCORS(rest.NewAlarmsHandler(service)))
+	mux.Handle("GET /vis/simulation", WithoutCORS(rest.NewSimulationStatusHandler(log, service)))
+	mux.Handle("GET /vis/state", WithoutCORS(rest.NewGetStateHandler(log, service)))
+	mux.Handle("GET /vis/history", WithoutCORS(rest.NewHistoryHandler(log, service)))
+
+	return mux
+}
+
+// options of every simulated line from configuration
+func lineOptions(cfg config.Config) core.Options {
+	opts := core.Options{
+		ControlLease:     cfg.ControlLease,
+		WatchdogTimeout:  cfg.WatchdogTimeout,
+		HistoryRetention: cfg.HistoryRetention,
+		IdealCycleTime:   cfg.IdealCycleTime,
+		Seed:             cfg.Seed,
+		Sensors:          make(map[string]core.SensorCharacteristics),
+		Encoders:         make(map[string]core.EncoderCharacteristics),
+		Motion:           core.MotionProfile(cfg.Motion),
+	}
+	for id, c := range cfg.Sensors {
+		opts.Sensors[id] = core.SensorCharacteristics(c)
+	}
+	for id, c := range cfg.Encoders {
+		opts.Encoders[id] = core.EncoderCharacteristics(c)
+	}
+	return opts
+}
+
+// simulates production driven by controller on virtual clock as fast as possible and reports kpis
+func runFast(cfg config.Config, log *slog.Logger, seed int64, drive func(ctx context.Context, s *core.Service) error) error {
+	// line behaves like configured one, but without watchdog and history which slow the run down
+	opts := lineOptions(cfg)
+	opts.FastMode = true
+	opts.WatchdogTimeout = 0
+	opts.HistoryRetention = 0
+	service := core.NewService(log, opts)
+	defer service.Close()
+
+	if cfg.StateFile != "" {
+		if err := loadStateFile(service, cfg.StateFile); err != nil {
+			return err
+		}
+	}
+	service.Reset(core.ResetOptions{Seed: &seed})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start, simStart := time.Now(), service.Now()
+	err := drive(ctx, service)
+	report := service.GetAnalytics()
+
+	log.Info("fast run finished",
+		"sorted", report.Sorted,
+		"simulated", service.Now().Sub(simStart).Round(time.Second),
+		"took", time.Since(start).Round(time.Millisecond),
+		"avgCycleTime", report.AvgCycleTime.Round(time.Millisecond),
+		"throughputPerHour", report.Throughput,
+		"oee", report.OEE,
+	)
+
+	return err
+}
+
+func loadStateFile(service *core.Service, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read state file: %w", err)
+	}
+
+	var snap core.Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode state file: %w", err)
+	}
+
+	if err := service.SetInitialState(snap); err != nil {
+		return err
+	}
+
+	return service.Restore(snap)
+}
+
 func mustMakeLogger(logLevel string) *slog.Logger {
 	var level slog.Level
 	err := level.UnmarshalText([]byte(logLevel))
@@ -0,0 +1,444 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+var (
+	ErrGoalInvalid = errors.New("invalid plan goal")
+	ErrNoPlan      = errors.New("no command sequence reaches goal")
+)
+
+const (
+	maxStates = 500000 // search gives up after that many visited states
+
+	// same as line hardware, numeration from zero in carousel gripper pos
+	carouselSlots = 6
+	drillSlot     = 5
+	binCapacity   = 10
+	maxPucks      = carouselSlots + 4 // gripper, start, packaging and sorting hold one puck, so are goals and colors at most
+)
+
+// high level commands, pick and place include moving gripper to station
+const (
+	CmdPick      = "pick"
+	CmdPlace     = "place"
+	CmdRotate    = "rotate"
+	CmdDrill     = "drill"
+	CmdPackage   = "package"
+	CmdSort      = "sort"
+	CmdEmptyBins = "empty_bins"
+)
+
+// stations gripper can reach, from left to right
+const (
+	StationCarousel  = "carousel"
+	StationStart     = "start"
+	StationPackaging = "packaging"
+	StationSorting   = "sorting"
+)
+
+// puck locations besides stations
+const (
+	LocationGripper = "gripper"
+	LocationSorted  = "sorted"
+)
+
+type Step struct {
+	Command string
+	Station string // only for pick and place
+}
+
+func (s Step) String() string {
+	if s.Station == "" {
+		return s.Command
+	}
+	return s.Command + " " + s.Station
+}
+
+// wanted final state of one puck, puck is chosen by id or by its current location
+type PuckGoal struct {
+	Id       int
+	From     string // station or gripper
+	Slot     int    // carousel slot if From is carousel
+	Location string // station, gripper or sorted, any if empty
+	Drilled  *bool  // any if not set
+	Packaged *bool  // any if not set
+}
+
+// all puck goals should hold at once
+type Goal struct {
+	Pucks []PuckGoal
+}
+
+// puck in abstract state, zero is no puck.
+// pucks without goal are known only by color, so same ones are interchangeable and search space stays small
+type puck uint8
+
+func newPuck(kind int, drilled, packaged bool) puck {
+	p := puck(kind+1) << 2
+	if drilled {
+		p |= 1
+	}
+	if packaged {
+		p |= 2
+	}
+	return p
+}
+
+// goal index for pucks with goal, number of goals plus color index for others
+func (p puck) kind() int {
+	return int(p>>2) - 1
+}
+
+func (p puck) isDrilled() bool {
+	return p&1 != 0
+}
+
+func (p puck) isPackaged() bool {
+	return p&2 != 0
+}
+
+// abstract line state, comparable so it can be map key
+type state struct {
+	gripper   puck
+	start     puck
+	carousel  [carouselSlots]puck
+	packaging puck
+	sorting   puck
+
+	sorted [maxPucks]puck // sorted pucks with goal by goal index
+	bins   [maxPucks]int8 // bin level by color index
+}
+
+type target struct {
+	location string
+	drilled  *bool
+	packaged *bool
+	color    int
+}
+
+type planner struct {
+	colors  []string
+	targets []target
+}
+
+// searches shortest sequence of commands taking line from snapshot to goal
+func Plan(snap core.Snapshot, goal Goal) ([]Step, error) {
+	if len(snap.Carousel.Slots) != carouselSlots {
+		return nil, fmt.Errorf("%w: carousel should have %d slots", ErrGoalInvalid, carouselSlots)
+	}
+	if len(goal.Pucks) == 0 {
+		return nil, fmt.Errorf("%w: no puck goals", ErrGoalInvalid)
+	}
+
+	p := &planner{}
+
+	chosen := make(map[*core.PuckState]int) // puck -> goal index
+	for i, g := range goal.Pucks {
+		ps, err := choose(snap, g)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := chosen[ps]; found {
+			return nil, fmt.Errorf("%w: several goals for one puck", ErrGoalInvalid)
+		}
+		chosen[ps] = i
+
+		switch g.Location {
+		case "", StationCarousel, StationStart, StationPackaging, StationSorting, LocationGripper, LocationSorted:
+		default:
+			return nil, fmt.Errorf("%w: unknown location %q", ErrGoalInvalid, g.Location)
+		}
+
+		p.targets = append(p.targets, target{
+			location: g.Location,
+			drilled:  g.Drilled,
+			packaged: g.Packaged,
+		})
+	}
+
+	return p.search(p.load(snap, chosen))
+}
+
+// puck on line chosen by id or by location
+func choose(snap core.Snapshot, g PuckGoal) (*core.PuckState, error) {
+	var res *core.PuckState
+
+	switch {
+	case g.Id != 0:
+		for _, ps := range lineSlots(snap) {
+			if ps != nil && ps.Id == g.Id {
+				res = ps
+			}
+		}
+	case g.From == StationCarousel:
+		if g.Slot < 0 || g.Slot >= carouselSlots {
+			return nil, fmt.Errorf("%w: bad carousel slot %d", ErrGoalInvalid, g.Slot)
+		}
+		res = snap.Carousel.Slots[g.Slot]
+	case g.From == LocationGripper:
+		res = snap.Gripper.Puck
+	case g.From == StationStart:
+		res = snap.Start.Puck
+	case g.From == StationPackaging:
+		res = snap.Packaging.Puck
+	case g.From == StationSorting:
+		res = snap.Sorting.Puck
+	case g.From != "":
+		return nil, fmt.Errorf("%w: unknown location %q", ErrGoalInvalid, g.From)
+	default:
+		return nil, fmt.Errorf("%w: puck should be chosen by id or location", ErrGoalInvalid)
+	}
+
+	if res == nil {
+		return nil, fmt.Errorf("%w: puck not found on line", ErrGoalInvalid)
+	}
+
+	return res, nil
+}
+
+func (p *planner) load(snap core.Snapshot, chosen map[*core.PuckState]int) state {
+	var st state
+
+	add := func(ps *core.PuckState) puck {
+		if ps == nil {
+			return 0
+		}
+
+		color := slices.Index(p.colors, ps.Color)
+		if color < 0 {
+			color = len(p.colors)
+			p.colors = append(p.colors, ps.Color)
+			st.bins[color] = int8(min(snap.Sorting.BinLevels[ps.Color], binCapacity))
+		}
+
+		kind, found := chosen[ps]
+		if found {
+			p.targets[kind].color = color
+		} else {
+			kind = len(p.targets) + color
+		}
+
+		return newPuck(kind, ps.IsDrilled, ps.IsPackaged)
+	}
+
+	st.gripper = add(snap.Gripper.Puck)
+	st.start = add(snap.Start.Puck)
+	for i, ps := range snap.Carousel.Slots {
+		st.carousel[i] = add(ps)
+	}
+	st.packaging = add(snap.Packaging.Puck)
+	st.sorting = add(snap.Sorting.Puck)
+
+	return st
+}
+
+// breadth first search, every command costs the same
+func (p *planner) search(start state) ([]Step, error) {
+	type visit struct {
+		prev state
+		step Step
+	}
+
+	visited := map[state]visit{start: {}}
+	queue := []state{start}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		if p.reached(cur) {
+			steps := make([]Step, 0)
+			for cur != start {
+				v := visited[cur]
+				steps = append(steps, v.step)
+				cur = v.prev
+			}
+			slices.Reverse(steps)
+			return steps, nil
+		}
+
+		for _, n := range p.next(cur) {
+			if _, found := visited[n.state]; found {
+				continue
+			}
+			if len(visited) >= maxStates {
+				return nil, fmt.Errorf("%w: search limit of %d states exceeded", ErrNoPlan, maxStates)
+			}
+
+			visited[n.state] = visit{prev: cur, step: n.step}
+			queue = append(queue, n.state)
+		}
+	}
+
+	return nil, ErrNoPlan
+}
+
+func (p *planner) reached(st state) bool {
+	for i, t := range p.targets {
+		location, pk := st.find(i)
+		if t.location != "" && location != t.location {
+			return false
+		}
+		if t.drilled != nil && pk.isDrilled() != *t.drilled {
+			return false
+		}
+		if t.packaged != nil && pk.isPackaged() != *t.packaged {
+			return false
+		}
+	}
+	return true
+}
+
+type transition struct {
+	step  Step
+	state state
+}
+
+// commands allowed in state with states they lead to, mirrors core preconditions
+func (p *planner) next(st state) []transition {
+	res := make([]transition, 0)
+
+	if st.gripper == 0 {
+		for _, station := range []string{StationCarousel, StationStart, StationPackaging} {
+			pk := st.at(station)
+			if pk == 0 {
+				continue
+			}
+			// only packaged puck can leave packaging
+			if station == StationPackaging && !pk.isPackaged() {
+				continue
+			}
+
+			n := st
+			n.set(station, 0)
+			n.gripper = pk
+			res = append(res, transition{Step{CmdPick, station}, n})
+		}
+	} else {
+		packaged := st.gripper.isPackaged()
+		for _, station := range []string{StationCarousel, StationStart, StationPackaging, StationSorting} {
+			if st.at(station) != 0 {
+				continue
+			}
+			if (station == StationCarousel || station == StationPackaging) && packaged {
+				continue
+			}
+			if station == StationSorting && !packaged {
+				continue
+			}
+
+			n := st
+			n.set(station, st.gripper)
+			n.gripper = 0
+			res = append(res, transition{Step{CmdPlace, station}, n})
+		}
+	}
+
+	if st.carousel != [carouselSlots]puck{} {
+		n := st
+		for i := range st.carousel {
+			n.carousel[(i+1)%carouselSlots] = st.carousel[i]
+		}
+		res = append(res, transition{Step{Command: CmdRotate}, n})
+	}
+
+	if pk := st.carousel[drillSlot]; pk != 0 && !pk.isDrilled() {
+		n := st
+		n.carousel[drillSlot] |= 1
+		res = append(res, transition{Step{Command: CmdDrill}, n})
+	}
+
+	if pk := st.packaging; pk != 0 && !pk.isPackaged() {
+		n := st
+		n.packaging |= 2
+		res = append(res, transition{Step{Command: CmdPackage}, n})
+	}
+
+	if pk := st.sorting; pk != 0 && st.bins[p.color(pk.kind())] < binCapacity {
+		n := st
+		n.sorting = 0
+		n.bins[p.color(pk.kind())]++
+		if pk.kind() < len(p.targets) {
+			n.sorted[pk.kind()] = pk
+		}
+		res = append(res, transition{Step{Command: CmdSort}, n})
+	}
+
+	if slices.Contains(st.bins[:len(p.colors)], binCapacity) {
+		n := st
+		n.bins = [maxPucks]int8{}
+		res = append(res, transition{Step{Command: CmdEmptyBins}, n})
+	}
+
+	return res
+}
+
+func (p *planner) color(kind int) int {
+	if kind < len(p.targets) {
+		return p.targets[kind].color
+	}
+	return kind - len(p.targets)
+}
+
+// puck at station or in gripper, for carousel it is slot under gripper
+func (st state) at(location string) puck {
+	switch location {
+	case LocationGripper:
+		return st.gripper
+	case StationStart:
+		return st.start
+	case StationCarousel:
+		return st.carousel[0]
+	case StationPackaging:
+		return st.packaging
+	case StationSorting:
+		return st.sorting
+	}
+	return 0
+}
+
+// puck placing and taking is done on carousel slot under gripper
+func (st *state) set(station string, pk puck) {
+	switch station {
+	case StationStart:
+		st.start = pk
+	case StationCarousel:
+		st.carousel[0] = pk
+	case StationPackaging:
+		st.packaging = pk
+	case StationSorting:
+		st.sorting = pk
+	}
+}
+
+// location of puck with goal and its current attributes
+func (st state) find(kind int) (string, puck) {
+	if st.sorted[kind] != 0 {
+		return LocationSorted, st.sorted[kind]
+	}
+
+	for _, location := range []string{LocationGripper, StationStart, StationPackaging, StationSorting} {
+		if pk := st.at(location); pk != 0 && pk.kind() == kind {
+			return location, pk
+		}
+	}
+	for _, pk := range st.carousel {
+		if pk != 0 && pk.kind() == kind {
+			return StationCarousel, pk
+		}
+	}
+
+	return "", 0
+}
+
+func lineSlots(snap core.Snapshot) []*core.PuckState {
+	slots := []*core.PuckState{snap.Gripper.Puck, snap.Start.Puck}
+	slots = append(slots, snap.Carousel.Slots...)
+	return append(slots, snap.Packaging.Puck, snap.Sorting.Puck)
+}
@@ -0,0 +1,100 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrControllerNotFound = errors.New("controller not found")
+	ErrAlreadyRunning     = errors.New("plc is running already")
+	ErrNotRunning         = errors.New("plc is not running")
+)
+
+// process outputs driving line mechanics, line has no real plc outputs for them so they live next to simulator sensors.
+// gripper drives move gripper while set, gripper stops when drive is released, set drives in two directions stop it too.
+// carousel, drill, packaging, sorting, feed and empty bins outputs start their operation on rising edge
+const (
+	OutGripperLeft   = "ns:1, i:7"
+	OutGripperRight  = "ns:1, i:8"
+	OutGripperUp     = "ns:1, i:9"
+	OutGripperDown   = "ns:1, i:10"
+	OutGripperOpen   = "ns:1, i:11" // gripper is closed when reset
+	OutCarouselStep  = "ns:1, i:12"
+	OutDrill         = "ns:1, i:13"
+	OutPack          = "ns:1, i:14"
+	OutSort          = "ns:1, i:15"
+	OutFeed          = "ns:1, i:16"
+	OutEmptySortBins = "ns:1, i:17"
+)
+
+// gripper encoders of simulator read into registers, ids follow outputs above so they do not collide
+const (
+	RegGripperHorizontal = "ns:1, i:18"
+	RegGripperVertical   = "ns:1, i:19"
+)
+
+// inputs read at start of scan
+type ProcessImage struct {
+	Time      time.Time        // simulation time
+	Cycle     uint64           // scan number from start
+	Inputs    map[string]bool  // sensor id -> value
+	Registers map[string]int64 // encoder id -> counts
+}
+
+// outputs written at end of scan, output id -> value.
+// missing outputs are reset, actuators of line are driven by their ids too
+type Outputs map[string]bool
+
+// control logic called every scan cycle, like plc program
+type Controller interface {
+	Scan(in ProcessImage) Outputs
+}
+
+// makes new controller instance, every run gets fresh one
+type Factory func() Controller
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Factory) // name -> factory
+)
+
+// registers controller compiled into binary, should be called from init of controller package
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, found := registry[name]; found {
+		panic(fmt.Sprintf("plc controller %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// returns sorted names of registered controllers
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	res := make([]string, 0, len(registry))
+	for name := range registry {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+func New(name string) (Controller, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	factory, found := registry[name]
+	if !found {
+		return nil, ErrControllerNotFound
+	}
+
+	return factory(), nil
+}
@@ -0,0 +1,353 @@
+package plc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Razzle131/line316/tp_model/core"
+)
+
+const (
+	controlOwner = "plc"
+
+	scanTime = 10 * time.Millisecond // same as simulation tick
+)
+
+var drives = []string{OutGripperLeft, OutGripperRight, OutGripperUp, OutGripperDown}
+
+type Status struct {
+	Running    bool
+	Controller string
+	Cycles     uint64
+	StartedAt  *time.Time
+	Errors     int // rejected commands, plc keeps running after them
+	LastError  error
+}
+
+// runs in-process controller in scan cycle on one line, one controller at a time
+type Runtime struct {
+	log *slog.Logger
+	s   *core.Service
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	status Status
+
+	token    string
+	prev     Outputs // outputs of previous scan, only changes are applied
+	drive    string  // gripper drive in effect
+	stopping bool    // gripper is stopped before next drive
+	failed   string  // drive which was rejected, not retried until released
+}
+
+func NewRuntime(log *slog.Logger, s *core.Service) *Runtime {
+	return &Runtime{
+		log: log.With("controller", controlOwner),
+		s:   s,
+	}
+}
+
+// takes line control and starts scanning until stopped
+func (r *Runtime) Start(name string, ctrl Controller) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status.Running {
+		return ErrAlreadyRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := r.begin(name, cancel); err != nil {
+		cancel()
+		return err
+	}
+
+	go func() {
+		defer cancel()
+		r.finish(r.loop(ctx, ctrl, 0))
+	}()
+
+	return nil
+}
+
+// scans for d of simulation time in caller goroutine, in fast mode caller drives the clock this way
+func (r *Runtime) Run(ctx context.Context, name string, ctrl Controller, d time.Duration) error {
+	r.mu.Lock()
+	if r.status.Running {
+		r.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := r.begin(name, cancel); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	r.mu.Unlock()
+
+	err := r.loop(ctx, ctrl, d)
+	r.finish(err)
+
+	return err
+}
+
+// stops scanning and waits for it, gripper is halted
+func (r *Runtime) Stop() error {
+	r.mu.Lock()
+	if !r.status.Running {
+		r.mu.Unlock()
+		return ErrNotRunning
+	}
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+
+	cancel()
+	<-done
+
+	return nil
+}
+
+func (r *Runtime) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// should be called with mu held
+func (r *Runtime) begin(name string, cancel context.CancelFunc) error {
+	lease, err := r.s.AcquireControl(controlOwner)
+	if err != nil {
+		return err
+	}
+	r.token = lease.Token
+
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	r.prev = make(Outputs)
+	r.drive, r.stopping, r.failed = "", false, ""
+
+	now := r.s.Now()
+	r.status = Status{
+		Running:    true,
+		Controller: name,
+		StartedAt:  &now,
+	}
+
+	r.log.Info("plc started", "program", name)
+
+	return nil
+}
+
+// scans until error or ctx is done, runs forever if d is zero
+func (r *Runtime) loop(ctx context.Context, ctrl Controller, d time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-r.s.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	end := r.s.Now().Add(d)
+	for cycle := uint64(0); ; cycle++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// breakpoint pauses scans too, station commands are refused on paused line
+		if err := r.s.WaitResumed(ctx); err != nil {
+			return err
+		}
+
+		now := r.s.Now()
+		if d > 0 && !now.Before(end) {
+			return nil
+		}
+
+		// scan keeps lease and watchdog alive, like client commands through api do
+		if _, err := r.s.HeartbeatControl(r.token); err != nil {
+			return err
+		}
+		r.s.FeedWatchdog()
+
+		out := ctrl.Scan(ProcessImage{
+			Time:      now,
+			Cycle:     cycle,
+			Inputs:    r.s.SensorValues(),
+			Registers: r.s.EncoderValues(),
+		})
+		r.apply(ctx, out)
+
+		r.mu.Lock()
+		r.status.Cycles++
+		r.mu.Unlock()
+
+		if err := r.s.Sleep(ctx, scanTime); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Runtime) finish(err error) {
+	// outputs are reset like on plc stop
+	r.apply(context.Background(), Outputs{})
+	// halted gripper does not need running clock to stop, so stop does not wait for paused line
+	r.s.HaltGripper()
+	r.s.ReleaseControl(r.token)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.Running = false
+	if err != nil && !errors.Is(err, context.Canceled) {
+		r.status.LastError = err
+		r.log.Error("plc stopped", "program", r.status.Controller, "error", err)
+	} else {
+		r.log.Info("plc stopped", "program", r.status.Controller, "cycles", r.status.Cycles)
+	}
+	close(r.done)
+}
+
+// applies changed outputs in id order so scan result does not depend on map order
+func (r *Runtime) apply(ctx context.Context, out Outputs) {
+	ids := make([]string, 0, len(out)+len(r.prev))
+	for id := range out {
+		ids = append(ids, id)
+	}
+	for id := range r.prev {
+		if _, found := out[id]; !found {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		value, prev := out[id], r.prev[id]
+		if value == prev {
+			continue
+		}
+
+		var err error
+		switch id {
+		case OutGripperLeft, OutGripperRight, OutGripperUp, OutGripperDown:
+			// drives are applied every scan below
+		case OutGripperOpen:
+			if value {
+				err = r.s.OpenGripper()
+			} else {
+				err = r.s.CloseGripper()
+			}
+		case OutCarouselStep, OutDrill, OutPack, OutSort, OutFeed, OutEmptySortBins:
+			if value {
+				err = r.pulse(ctx, id)
+			}
+		default:
+			err = r.s.SetActuatorValue(id, value)
+		}
+		r.fail(err)
+	}
+
+	r.applyDrive(out)
+
+	r.prev = make(Outputs, len(out))
+	for id, value := range out {
+		r.prev[id] = value
+	}
+}
+
+func (r *Runtime) pulse(ctx context.Context, id string) error {
+	switch id {
+	case OutCarouselStep:
+		return r.s.RotateCarousel(ctx)
+	case OutDrill:
+		return r.s.DrillPuck()
+	case OutPack:
+		return r.s.PackagePuck(ctx)
+	case OutSort:
+		return r.s.SortPuck(ctx)
+	case OutFeed:
+		return r.s.PlaceNewStartPuck()
+	case OutEmptySortBins:
+		r.s.EmptySortingBins()
+	}
+	return nil
+}
+
+// gripper moves on one axis at a time, so it is stopped before new drive is started
+func (r *Runtime) applyDrive(out Outputs) {
+	want := ""
+	for _, id := range drives {
+		if !out[id] {
+			continue
+		}
+		if want != "" {
+			// conflicting drives are interlocked
+			want = ""
+			break
+		}
+		want = id
+	}
+
+	if want != r.failed {
+		r.failed = ""
+	}
+
+	if r.stopping {
+		if !core.GripperIdleCondition()(r.s) {
+			return
+		}
+		r.s.EnableMovingGripper()
+		r.stopping = false
+		r.drive = ""
+	}
+
+	if want == r.drive || (want != "" && want == r.failed) {
+		return
+	}
+
+	if r.drive != "" {
+		r.s.StopGripper()
+		r.stopping = true
+		return
+	}
+
+	var err error
+	switch want {
+	case OutGripperLeft:
+		err = r.s.MoveGripperLeft()
+	case OutGripperRight:
+		err = r.s.MoveGripperRight()
+	case OutGripperUp:
+		err = r.s.MoveGripperUp()
+	case OutGripperDown:
+		err = r.s.MoveGripperDown()
+	}
+	if err != nil {
+		r.failed = want
+		r.fail(err)
+		return
+	}
+
+	r.drive = want
+}
+
+func (r *Runtime) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.Errors++
+	r.status.LastError = err
+}
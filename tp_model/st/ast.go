@@ -0,0 +1,148 @@
+package st
+
+import (
+	"fmt"
+	"time"
+)
+
+type dataType int
+
+const (
+	typeBool dataType = iota
+	typeInt
+	typeTime
+)
+
+func (t dataType) String() string {
+	switch t {
+	case typeBool:
+		return "BOOL"
+	case typeInt:
+		return "INT"
+	case typeTime:
+		return "TIME"
+	}
+	return fmt.Sprintf("type(%d)", int(t))
+}
+
+// go value of stored value
+func (t dataType) value(v int64) any {
+	switch t {
+	case typeBool:
+		return v != 0
+	case typeTime:
+		return time.Duration(v)
+	}
+	return v
+}
+
+// elementary types, integers are 64 bit whatever width is declared
+var elementaryTypes = map[string]dataType{
+	"BOOL": typeBool,
+	"INT":  typeInt,
+	"DINT": typeInt,
+	"TIME": typeTime,
+}
+
+type varDecl struct {
+	name string
+	typ  dataType
+	init expr   // zero value if nil
+	at   string // bound node id, empty if not bound
+	dir  string // %I or %Q for bound variables
+	slot int
+	pos  Pos
+}
+
+type blockDecl struct {
+	name string
+	kind string // function block type like TON
+	spec *blockSpec
+	slot int
+	pos  Pos
+}
+
+type expr interface {
+	typ() dataType
+}
+
+type literal struct {
+	t dataType
+	v int64
+}
+
+type varRef struct {
+	v *varDecl
+}
+
+// input or output of function block instance
+type fieldRef struct {
+	b     *blockDecl
+	field string
+	t     dataType
+}
+
+type unary struct {
+	op  string
+	x   expr
+	t   dataType
+	pos Pos
+}
+
+type binary struct {
+	op   string
+	x, y expr
+	t    dataType
+	pos  Pos
+}
+
+func (e *literal) typ() dataType  { return e.t }
+func (e *varRef) typ() dataType   { return e.v.typ }
+func (e *fieldRef) typ() dataType { return e.t }
+func (e *unary) typ() dataType    { return e.t }
+func (e *binary) typ() dataType   { return e.t }
+
+type stmt interface{}
+
+type assign struct {
+	target expr // varRef or fieldRef
+	value  expr
+}
+
+type ifStmt struct {
+	conds  []expr
+	bodies [][]stmt
+	els    []stmt
+}
+
+type caseRange struct {
+	lo, hi int64
+}
+
+type caseClause struct {
+	labels []caseRange
+	body   []stmt
+}
+
+type caseStmt struct {
+	x       expr
+	clauses []caseClause
+	els     []stmt
+}
+
+type forStmt struct {
+	v            *varDecl
+	from, to, by expr
+	body         []stmt
+	pos          Pos
+}
+
+type callArg struct {
+	input string
+	value expr
+}
+
+type callStmt struct {
+	b    *blockDecl
+	args []callArg
+}
@@ -0,0 +1,209 @@
+package st
+
+import "time"
+
+// standard function block instance, inputs keep their values between calls like in iec 61131-3
+type block interface {
+	set(name string, v int64)
+	get(name string) int64
+	exec(now time.Time)
+}
+
+type blockSpec struct {
+	inputs  map[string]dataType
+	outputs map[string]dataType
+	fields  []string // inputs and outputs in display order
+	new     func() block
+}
+
+var blockSpecs = map[string]*blockSpec{
+	"TON": {
+		inputs:  map[string]dataType{"IN": typeBool, "PT": typeTime},
+		outputs: map[string]dataType{"Q": typeBool, "ET": typeTime},
+		fields:  []string{"IN", "PT", "Q", "ET"},
+		new:     func() block { return &timer{} },
+	},
+	"TOF": {
+		inputs:  map[string]dataType{"IN": typeBool, "PT": typeTime},
+		outputs: map[string]dataType{"Q": typeBool, "ET": typeTime},
+		fields:  []string{"IN", "PT", "Q", "ET"},
+		new:     func() block { return &timer{off: true} },
+	},
+	"R_TRIG": {
+		inputs:  map[string]dataType{"CLK": typeBool},
+		outputs: map[string]dataType{"Q": typeBool},
+		fields:  []string{"CLK", "Q"},
+		new:     func() block { return &trigger{} },
+	},
+	"F_TRIG": {
+		inputs:  map[string]dataType{"CLK": typeBool},
+		outputs: map[string]dataType{"Q": typeBool},
+		fields:  []string{"CLK", "Q"},
+		new:     func() block { return &trigger{falling: true} },
+	},
+	"SR": {
+		inputs:  map[string]dataType{"S1": typeBool, "R": typeBool},
+		outputs: map[string]dataType{"Q1": typeBool},
+		fields:  []string{"S1", "R", "Q1"},
+		new:     func() block { return &bistable{} },
+	},
+	"RS": {
+		inputs:  map[string]dataType{"S": typeBool, "R1": typeBool},
+		outputs: map[string]dataType{"Q1": typeBool},
+		fields:  []string{"S", "R1", "Q1"},
+		new:     func() block { return &bistable{resetDominant: true} },
+	},
+}
+
+func (s *blockSpec) field(name string) (dataType, bool) {
+	if t, found := s.inputs[name]; found {
+		return t, true
+	}
+	t, found := s.outputs[name]
+	return t, found
+}
+
+// on delay timer, or off delay timer if off is set
+type timer struct {
+	off bool
+
+	in      bool
+	pt      time.Duration
+	q       bool
+	et      time.Duration
+	prevIn  bool
+	running bool
+	start   time.Time
+}
+
+func (t *timer) set(name string, v int64) {
+	switch name {
+	case "IN":
+		t.in = v != 0
+	case "PT":
+		t.pt = time.Duration(v)
+	}
+}
+
+func (t *timer) get(name string) int64 {
+	switch name {
+	case "IN":
+		return boolValue(t.in)
+	case "PT":
+		return int64(t.pt)
+	case "Q":
+		return boolValue(t.q)
+	case "ET":
+		return int64(t.et)
+	}
+	return 0
+}
+
+func (t *timer) exec(now time.Time) {
+	// timing starts on rising edge for on delay and on falling edge for off delay
+	edge := t.in && !t.prevIn
+	if t.off {
+		edge = !t.in && t.prevIn
+	}
+	t.prevIn = t.in
+
+	if edge {
+		t.running = true
+		t.start = now
+	}
+
+	if t.in != t.off {
+		// on delay with input set or off delay with input reset
+		if t.running {
+			t.et = min(now.Sub(t.start), t.pt)
+		}
+		if !t.off {
+			t.q = t.et >= t.pt
+		} else {
+			t.q = t.running && t.et < t.pt
+		}
+		return
+	}
+
+	t.running = false
+	t.et = 0
+	t.q = t.off
+}
+
+type trigger struct {
+	falling bool
+
+	clk  bool
+	q    bool
+	prev bool
+}
+
+func (t *trigger) set(name string, v int64) {
+	if name == "CLK" {
+		t.clk = v != 0
+	}
+}
+
+func (t *trigger) get(name string) int64 {
+	switch name {
+	case "CLK":
+		return boolValue(t.clk)
+	case "Q":
+		return boolValue(t.q)
+	}
+	return 0
+}
+
+func (t *trigger) exec(time.Time) {
+	if t.falling {
+		t.q = !t.clk && t.prev
+	} else {
+		t.q = t.clk && !t.prev
+	}
+	t.prev = t.clk
+}
+
+// set dominant latch, or reset dominant if resetDominant is set
+type bistable struct {
+	resetDominant bool
+
+	set1   bool
+	reset1 bool
+	q      bool
+}
+
+func (b *bistable) set(name string, v int64) {
+	switch name {
+	case "S1", "S":
+		b.set1 = v != 0
+	case "R", "R1":
+		b.reset1 = v != 0
+	}
+}
+
+func (b *bistable) get(name string) int64 {
+	switch name {
+	case "S1", "S":
+		return boolValue(b.set1)
+	case "R", "R1":
+		return boolValue(b.reset1)
+	case "Q1":
+		return boolValue(b.q)
+	}
+	return 0
+}
+
+func (b *bistable) exec(time.Time) {
+	if b.resetDominant {
+		b.q = !b.reset1 && (b.set1 || b.q)
+	} else {
+		b.q = b.set1 || (!b.reset1 && b.q)
+	}
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
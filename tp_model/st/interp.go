@@ -0,0 +1,209 @@
+package st
+
+import (
+	"fmt"
+	"time"
+)
+
+const maxLoopIterations = 10000 // of all FOR statements in one scan, nested ones too, so scan time stays bounded
+
+// execution state of program, values are int64 whatever the type is: bool is 0 or 1, time is in nanoseconds
+type machine struct {
+	vars   []int64
+	blocks []block
+	now    time.Time
+	loops  int // FOR iterations left in current scan
+}
+
+func runtimeError(pos Pos, format string, args ...any) error {
+	return fmt.Errorf("%w: %s: %s", ErrRuntime, pos, fmt.Sprintf(format, args...))
+}
+
+func (m *machine) execAll(body []stmt) error {
+	for _, s := range body {
+		if err := m.exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *machine) exec(s stmt) error {
+	switch s := s.(type) {
+	case *assign:
+		v, err := m.eval(s.value)
+		if err != nil {
+			return err
+		}
+		switch t := s.target.(type) {
+		case *varRef:
+			m.vars[t.v.slot] = v
+		case *fieldRef:
+			m.blocks[t.b.slot].set(t.field, v)
+		}
+
+	case *callStmt:
+		b := m.blocks[s.b.slot]
+		for _, arg := range s.args {
+			v, err := m.eval(arg.value)
+			if err != nil {
+				return err
+			}
+			b.set(arg.input, v)
+		}
+		b.exec(m.now)
+
+	case *ifStmt:
+		for i, cond := range s.conds {
+			v, err := m.eval(cond)
+			if err != nil {
+				return err
+			}
+			if v != 0 {
+				return m.execAll(s.bodies[i])
+			}
+		}
+		return m.execAll(s.els)
+
+	case *caseStmt:
+		x, err := m.eval(s.x)
+		if err != nil {
+			return err
+		}
+		for _, clause := range s.clauses {
+			for _, r := range clause.labels {
+				if x >= r.lo && x <= r.hi {
+					return m.execAll(clause.body)
+				}
+			}
+		}
+		return m.execAll(s.els)
+
+	case *forStmt:
+		return m.execFor(s)
+	}
+
+	return nil
+}
+
+func (m *machine) execFor(s *forStmt) error {
+	from, err := m.eval(s.from)
+	if err != nil {
+		return err
+	}
+	to, err := m.eval(s.to)
+	if err != nil {
+		return err
+	}
+	by, err := m.eval(s.by)
+	if err != nil {
+		return err
+	}
+	if by == 0 {
+		return runtimeError(s.pos, "FOR step is zero")
+	}
+
+	m.vars[s.v.slot] = from
+	for {
+		v := m.vars[s.v.slot]
+		if (by > 0 && v > to) || (by < 0 && v < to) {
+			return nil
+		}
+		if m.loops == 0 {
+			return runtimeError(s.pos, "FOR loops exceeded %d iterations in one scan", maxLoopIterations)
+		}
+		m.loops--
+
+		if err := m.execAll(s.body); err != nil {
+			return err
+		}
+		m.vars[s.v.slot] += by
+	}
+}
+
+func (m *machine) eval(e expr) (int64, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.v, nil
+
+	case *varRef:
+		return m.vars[e.v.slot], nil
+
+	case *fieldRef:
+		return m.blocks[e.b.slot].get(e.field), nil
+
+	case *unary:
+		x, err := m.eval(e.x)
+		if err != nil {
+			return 0, err
+		}
+		if e.op == "NOT" {
+			return 1 - x, nil
+		}
+		return -x, nil
+
+	case *binary:
+		return m.evalBinary(e)
+	}
+
+	return 0, fmt.Errorf("%w: unknown expression %T", ErrRuntime, e)
+}
+
+func (m *machine) evalBinary(e *binary) (int64, error) {
+	x, err := m.eval(e.x)
+	if err != nil {
+		return 0, err
+	}
+
+	// boolean operators are short circuit
+	switch e.op {
+	case "AND":
+		if x == 0 {
+			return 0, nil
+		}
+		return m.eval(e.y)
+	case "OR":
+		if x != 0 {
+			return 1, nil
+		}
+		return m.eval(e.y)
+	}
+
+	y, err := m.eval(e.y)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.op {
+	case "XOR":
+		return x ^ y, nil
+	case "=":
+		return boolValue(x == y), nil
+	case "<>":
+		return boolValue(x != y), nil
+	case "<":
+		return boolValue(x < y), nil
+	case ">":
+		return boolValue(x > y), nil
+	case "<=":
+		return boolValue(x <= y), nil
+	case ">=":
+		return boolValue(x >= y), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "MOD":
+		if y == 0 {
+			return 0, runtimeError(e.pos, "division by zero")
+		}
+		if e.op == "MOD" {
+			return x % y, nil
+		}
+		return x / y, nil
+	}
+
+	return 0, runtimeError(e.pos, "unknown operator %s", e.op)
+}
@@ -0,0 +1,196 @@
+package st
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokInt
+	tokTime
+	tokString
+	tokDirect // %I or %Q
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // keywords are upper case
+	pos  Pos
+}
+
+// position in source, numeration from one
+type Pos struct {
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+var keywords = map[string]bool{
+	"PROGRAM": true, "END_PROGRAM": true,
+	"VAR": true, "END_VAR": true, "AT": true,
+	"IF": true, "THEN": true, "ELSIF": true, "ELSE": true, "END_IF": true,
+	"CASE": true, "OF": true, "END_CASE": true,
+	"FOR": true, "TO": true, "BY": true, "DO": true, "END_FOR": true,
+	"TRUE": true, "FALSE": true,
+	"AND": true, "OR": true, "XOR": true, "NOT": true, "MOD": true,
+}
+
+// longest first
+var operators = []string{":=", "<=", ">=", "<>", "=>", "..", "(", ")", ";", ":", ",", ".", "=", "<", ">", "+", "-", "*", "/", "&"}
+
+type lexer struct {
+	src  []rune
+	i    int
+	line int
+	col  int
+}
+
+func lex(src string) ([]token, error) {
+	l := &lexer{src: []rune(src), line: 1, col: 1}
+
+	res := make([]token, 0)
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, tok)
+		if tok.kind == tokEOF {
+			return res, nil
+		}
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+
+	pos := Pos{l.line, l.col}
+	if l.i >= len(l.src) {
+		return token{kind: tokEOF, pos: pos}, nil
+	}
+
+	c := l.src[l.i]
+	switch {
+	case c == '%':
+		l.advance()
+		if l.i >= len(l.src) {
+			return token{}, errorAt(pos, "expected I or Q after %%")
+		}
+		dir := unicode.ToUpper(l.src[l.i])
+		if dir != 'I' && dir != 'Q' {
+			return token{}, errorAt(pos, "expected I or Q after %%")
+		}
+		l.advance()
+		return token{kind: tokDirect, text: "%" + string(dir), pos: pos}, nil
+
+	case c == '\'':
+		l.advance()
+		start := l.i
+		for l.i < len(l.src) && l.src[l.i] != '\'' {
+			if l.src[l.i] == '\n' {
+				return token{}, errorAt(pos, "unterminated string")
+			}
+			l.advance()
+		}
+		if l.i >= len(l.src) {
+			return token{}, errorAt(pos, "unterminated string")
+		}
+		text := string(l.src[start:l.i])
+		l.advance()
+		return token{kind: tokString, text: text, pos: pos}, nil
+
+	case unicode.IsDigit(c):
+		start := l.i
+		for l.i < len(l.src) && (unicode.IsDigit(l.src[l.i]) || l.src[l.i] == '_') {
+			l.advance()
+		}
+		return token{kind: tokInt, text: strings.ReplaceAll(string(l.src[start:l.i]), "_", ""), pos: pos}, nil
+
+	case unicode.IsLetter(c) || c == '_':
+		start := l.i
+		for l.i < len(l.src) && (unicode.IsLetter(l.src[l.i]) || unicode.IsDigit(l.src[l.i]) || l.src[l.i] == '_') {
+			l.advance()
+		}
+		word := string(l.src[start:l.i])
+		upper := strings.ToUpper(word)
+
+		// time literal like T#1s500ms
+		if (upper == "T" || upper == "TIME") && l.i < len(l.src) && l.src[l.i] == '#' {
+			l.advance()
+			start := l.i
+			for l.i < len(l.src) && (unicode.IsLetter(l.src[l.i]) || unicode.IsDigit(l.src[l.i]) || l.src[l.i] == '_' || l.src[l.i] == '.') {
+				l.advance()
+			}
+			return token{kind: tokTime, text: string(l.src[start:l.i]), pos: pos}, nil
+		}
+
+		if keywords[upper] {
+			return token{kind: tokKeyword, text: upper, pos: pos}, nil
+		}
+		return token{kind: tokIdent, text: word, pos: pos}, nil
+	}
+
+	for _, op := range operators {
+		if l.hasPrefix(op) {
+			for range op {
+				l.advance()
+			}
+			return token{kind: tokOp, text: op, pos: pos}, nil
+		}
+	}
+
+	return token{}, errorAt(pos, "unexpected character %q", c)
+}
+
+// skips white space and comments, both (* *) and //
+func (l *lexer) skipSpace() error {
+	for l.i < len(l.src) {
+		switch {
+		case unicode.IsSpace(l.src[l.i]):
+			l.advance()
+		case l.hasPrefix("//"):
+			for l.i < len(l.src) && l.src[l.i] != '\n' {
+				l.advance()
+			}
+		case l.hasPrefix("(*"):
+			pos := Pos{l.line, l.col}
+			for !l.hasPrefix("*)") {
+				if l.i >= len(l.src) {
+					return errorAt(pos, "unterminated comment")
+				}
+				l.advance()
+			}
+			l.advance()
+			l.advance()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(l.src[l.i:min(l.i+len(s), len(l.src))]), s)
+}
+
+func (l *lexer) advance() {
+	if l.src[l.i] == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	l.i++
+}
@@ -0,0 +1,804 @@
+package st
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var daysRe = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+type parser struct {
+	toks []token
+	i    int
+
+	vars   map[string]*varDecl   // upper case name -> var
+	blocks map[string]*blockDecl // upper case name -> block instance
+	order  []any                 // declarations in source order
+	nVars  int
+	bound  map[string]Pos // output node id -> where it is bound
+}
+
+func errorAt(pos Pos, format string, args ...any) error {
+	return fmt.Errorf("%w: %s: %s", ErrCompile, pos, fmt.Sprintf(format, args...))
+}
+
+func parse(src string) (*Program, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		toks:   toks,
+		vars:   make(map[string]*varDecl),
+		blocks: make(map[string]*blockDecl),
+		bound:  make(map[string]Pos),
+	}
+
+	return p.program()
+}
+
+func (p *parser) program() (*Program, error) {
+	if err := p.expectKeyword("PROGRAM"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword("VAR") {
+		if err := p.varBlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := p.statements("END_PROGRAM")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("END_PROGRAM"); err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, errorAt(tok.pos, "unexpected %q after END_PROGRAM", tok.text)
+	}
+
+	return &Program{
+		name:  name.text,
+		order: p.order,
+		nVars: p.nVars,
+		body:  body,
+	}, nil
+}
+
+func (p *parser) varBlock() error {
+	p.next() // VAR
+
+	for !p.isKeyword("END_VAR") {
+		if err := p.declaration(); err != nil {
+			return err
+		}
+	}
+	p.next()
+
+	return nil
+}
+
+// name [, name] [AT %I 'id'] : type [:= init];
+func (p *parser) declaration() error {
+	names := make([]token, 0)
+	for {
+		name, err := p.expectIdent()
+		if err != nil {
+			return err
+		}
+		if _, found := p.lookup(name.text); found {
+			return errorAt(name.pos, "%s is declared twice", name.text)
+		}
+		names = append(names, name)
+
+		if !p.isOp(",") {
+			break
+		}
+		p.next()
+	}
+
+	var at, dir string
+	atPos := p.peek().pos
+	if p.isKeyword("AT") {
+		p.next()
+		tok := p.next()
+		if tok.kind != tokDirect {
+			return errorAt(tok.pos, "expected %%I or %%Q after AT")
+		}
+		dir = tok.text
+
+		id := p.next()
+		if id.kind != tokString {
+			return errorAt(id.pos, "expected node id like 'ns:1, i:1' after %s", dir)
+		}
+		at = id.text
+
+		if len(names) > 1 {
+			return errorAt(atPos, "only one variable can be bound to node id")
+		}
+	}
+
+	if err := p.expectOp(":"); err != nil {
+		return err
+	}
+	typeTok, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	typeName := strings.ToUpper(typeTok.text)
+
+	if spec, found := blockSpecs[typeName]; found {
+		if at != "" {
+			return errorAt(atPos, "function block cannot be bound to node id")
+		}
+		for _, name := range names {
+			b := &blockDecl{name: name.text, kind: typeName, spec: spec, slot: len(p.blocks), pos: name.pos}
+			p.blocks[strings.ToUpper(name.text)] = b
+			p.order = append(p.order, b)
+		}
+		return p.expectOp(";")
+	}
+
+	t, found := elementaryTypes[typeName]
+	if !found {
+		return errorAt(typeTok.pos, "unknown type %s", typeTok.text)
+	}
+	// encoder registers are read as INT inputs
+	if at != "" && t != typeBool && (t != typeInt || dir != "%I") {
+		return errorAt(atPos, "only BOOL variable or INT input can be bound to node id")
+	}
+	if dir == "%Q" {
+		if prev, found := p.bound[at]; found {
+			return errorAt(atPos, "output %q is bound already at %s", at, prev)
+		}
+		p.bound[at] = atPos
+	}
+
+	var init expr
+	if p.isOp(":=") {
+		p.next()
+		pos := p.peek().pos
+		init, err = p.expression()
+		if err != nil {
+			return err
+		}
+		if !isConstant(init) {
+			return errorAt(pos, "initial value should be constant")
+		}
+		if init.typ() != t {
+			return errorAt(pos, "cannot initialize %s with %s", t, init.typ())
+		}
+	}
+
+	for _, name := range names {
+		v := &varDecl{name: name.text, typ: t, init: init, at: at, dir: dir, slot: p.nVars, pos: name.pos}
+		p.nVars++
+		p.vars[strings.ToUpper(name.text)] = v
+		p.order = append(p.order, v)
+	}
+
+	return p.expectOp(";")
+}
+
+// statements until one of end keywords
+func (p *parser) statements(end ...string) ([]stmt, error) {
+	res := make([]stmt, 0)
+	for {
+		tok := p.peek()
+		if tok.kind == tokKeyword && contains(end, tok.text) {
+			return res, nil
+		}
+		// block closed by wrong keyword
+		if tok.kind == tokEOF || (tok.kind == tokKeyword && (strings.HasPrefix(tok.text, "END_") || tok.text == "ELSE" || tok.text == "ELSIF")) {
+			return nil, errorAt(tok.pos, "expected %s, got %q", strings.Join(unlabeled(end), " or "), tok.text)
+		}
+		// case labels end case clause body
+		if contains(end, "label") && (tok.kind == tokInt || (tok.kind == tokOp && tok.text == "-")) {
+			return res, nil
+		}
+
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			res = append(res, s)
+		}
+	}
+}
+
+func (p *parser) statement() (stmt, error) {
+	tok := p.peek()
+
+	switch {
+	case tok.kind == tokOp && tok.text == ";":
+		p.next()
+		return nil, nil
+	case tok.kind == tokKeyword && tok.text == "IF":
+		return p.ifStatement()
+	case tok.kind == tokKeyword && tok.text == "CASE":
+		return p.caseStatement()
+	case tok.kind == tokKeyword && tok.text == "FOR":
+		return p.forStatement()
+	case tok.kind == tokIdent:
+		if b, found := p.blocks[strings.ToUpper(tok.text)]; found && p.peekAt(1).text == "(" {
+			return p.callStatement(b)
+		}
+		return p.assignment()
+	}
+
+	return nil, errorAt(tok.pos, "unexpected %q", tok.text)
+}
+
+func (p *parser) assignment() (stmt, error) {
+	pos := p.peek().pos
+	target, err := p.reference()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := target.(type) {
+	case *varRef:
+		if t.v.dir == "%I" {
+			return nil, errorAt(pos, "%s is bound to input and cannot be written", t.v.name)
+		}
+	case *fieldRef:
+		if _, found := t.b.spec.inputs[t.field]; !found {
+			return nil, errorAt(pos, "%s.%s is output and cannot be written", t.b.name, t.field)
+		}
+	}
+
+	if err := p.expectOp(":="); err != nil {
+		return nil, err
+	}
+	valuePos := p.peek().pos
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if value.typ() != target.typ() {
+		return nil, errorAt(valuePos, "cannot assign %s to %s", value.typ(), target.typ())
+	}
+
+	return &assign{target: target, value: value}, p.expectOp(";")
+}
+
+// fb(IN := x, PT := T#1s);
+func (p *parser) callStatement(b *blockDecl) (stmt, error) {
+	p.next() // name
+	p.next() // (
+
+	call := &callStmt{b: b}
+	for !p.isOp(")") {
+		if len(call.args) > 0 {
+			if err := p.expectOp(","); err != nil {
+				return nil, err
+			}
+		}
+
+		input, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToUpper(input.text)
+		t, found := b.spec.inputs[name]
+		if !found {
+			return nil, errorAt(input.pos, "%s has no input %s", b.kind, input.text)
+		}
+
+		if err := p.expectOp(":="); err != nil {
+			return nil, err
+		}
+		pos := p.peek().pos
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if value.typ() != t {
+			return nil, errorAt(pos, "input %s.%s is %s, got %s", b.name, name, t, value.typ())
+		}
+
+		call.args = append(call.args, callArg{input: name, value: value})
+	}
+	p.next()
+
+	return call, p.expectOp(";")
+}
+
+func (p *parser) ifStatement() (stmt, error) {
+	res := &ifStmt{}
+
+	for {
+		p.next() // IF or ELSIF
+		cond, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		body, err := p.statements("ELSIF", "ELSE", "END_IF")
+		if err != nil {
+			return nil, err
+		}
+		res.conds = append(res.conds, cond)
+		res.bodies = append(res.bodies, body)
+
+		if !p.isKeyword("ELSIF") {
+			break
+		}
+	}
+
+	if p.isKeyword("ELSE") {
+		p.next()
+		els, err := p.statements("END_IF")
+		if err != nil {
+			return nil, err
+		}
+		res.els = els
+	}
+
+	if err := p.expectKeyword("END_IF"); err != nil {
+		return nil, err
+	}
+	return res, p.expectOp(";")
+}
+
+func (p *parser) caseStatement() (stmt, error) {
+	p.next() // CASE
+
+	pos := p.peek().pos
+	x, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if x.typ() != typeInt {
+		return nil, errorAt(pos, "CASE selector should be INT, got %s", x.typ())
+	}
+	if err := p.expectKeyword("OF"); err != nil {
+		return nil, err
+	}
+
+	res := &caseStmt{x: x}
+	for !p.isKeyword("ELSE") && !p.isKeyword("END_CASE") {
+		clause := caseClause{}
+		for {
+			lo, err := p.caseLabel()
+			if err != nil {
+				return nil, err
+			}
+			hi := lo
+			if p.isOp("..") {
+				p.next()
+				if hi, err = p.caseLabel(); err != nil {
+					return nil, err
+				}
+			}
+			clause.labels = append(clause.labels, caseRange{lo, hi})
+
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectOp(":"); err != nil {
+			return nil, err
+		}
+
+		body, err := p.statements("label", "ELSE", "END_CASE")
+		if err != nil {
+			return nil, err
+		}
+		clause.body = body
+		res.clauses = append(res.clauses, clause)
+	}
+
+	if p.isKeyword("ELSE") {
+		p.next()
+		els, err := p.statements("END_CASE")
+		if err != nil {
+			return nil, err
+		}
+		res.els = els
+	}
+
+	if err := p.expectKeyword("END_CASE"); err != nil {
+		return nil, err
+	}
+	return res, p.expectOp(";")
+}
+
+func (p *parser) caseLabel() (int64, error) {
+	sign := int64(1)
+	if p.isOp("-") {
+		p.next()
+		sign = -1
+	}
+
+	tok := p.next()
+	if tok.kind != tokInt {
+		return 0, errorAt(tok.pos, "expected integer case label")
+	}
+	v, err := strconv.ParseInt(tok.text, 10, 64)
+	if err != nil {
+		return 0, errorAt(tok.pos, "bad integer %s", tok.text)
+	}
+
+	return sign * v, nil
+}
+
+func (p *parser) forStatement() (stmt, error) {
+	forTok := p.next()
+
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	v, found := p.vars[strings.ToUpper(name.text)]
+	if !found {
+		return nil, errorAt(name.pos, "unknown variable %s", name.text)
+	}
+	if v.typ != typeInt || v.dir != "" {
+		return nil, errorAt(name.pos, "FOR variable should be unbound INT")
+	}
+
+	res := &forStmt{v: v, by: &literal{t: typeInt, v: 1}, pos: forTok.pos}
+
+	if err := p.expectOp(":="); err != nil {
+		return nil, err
+	}
+	if res.from, err = p.intExpression(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("TO"); err != nil {
+		return nil, err
+	}
+	if res.to, err = p.intExpression(); err != nil {
+		return nil, err
+	}
+	if p.isKeyword("BY") {
+		p.next()
+		if res.by, err = p.intExpression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("DO"); err != nil {
+		return nil, err
+	}
+
+	if res.body, err = p.statements("END_FOR"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("END_FOR"); err != nil {
+		return nil, err
+	}
+	return res, p.expectOp(";")
+}
+
+func (p *parser) condition() (expr, error) {
+	pos := p.peek().pos
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if e.typ() != typeBool {
+		return nil, errorAt(pos, "condition should be BOOL, got %s", e.typ())
+	}
+	return e, nil
+}
+
+func (p *parser) intExpression() (expr, error) {
+	pos := p.peek().pos
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if e.typ() != typeInt {
+		return nil, errorAt(pos, "expected INT, got %s", e.typ())
+	}
+	return e, nil
+}
+
+// operator levels from lowest precedence
+var binaryLevels = [][]string{
+	{"OR"},
+	{"XOR"},
+	{"AND", "&"},
+	{"=", "<>", "<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/", "MOD"},
+}
+
+func (p *parser) expression() (expr, error) {
+	return p.binaryLevel(0)
+}
+
+func (p *parser) binaryLevel(level int) (expr, error) {
+	if level == len(binaryLevels) {
+		return p.unaryExpression()
+	}
+
+	x, err := p.binaryLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		if (tok.kind != tokOp && tok.kind != tokKeyword) || !contains(binaryLevels[level], tok.text) {
+			return x, nil
+		}
+		p.next()
+
+		y, err := p.binaryLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		op := tok.text
+		if op == "&" {
+			op = "AND"
+		}
+		t, err := binaryType(op, x.typ(), y.typ())
+		if err != nil {
+			return nil, errorAt(tok.pos, "%s", err.Error())
+		}
+		x = &binary{op: op, x: x, y: y, t: t, pos: tok.pos}
+	}
+}
+
+func binaryType(op string, x, y dataType) (dataType, error) {
+	switch op {
+	case "OR", "XOR", "AND":
+		if x == typeBool && y == typeBool {
+			return typeBool, nil
+		}
+	case "=", "<>":
+		if x == y {
+			return typeBool, nil
+		}
+	case "<", ">", "<=", ">=":
+		if x == y && x != typeBool {
+			return typeBool, nil
+		}
+	case "+", "-":
+		if x == y && x != typeBool {
+			return x, nil
+		}
+	case "*", "/":
+		if x == typeInt && y == typeInt {
+			return typeInt, nil
+		}
+		if x == typeTime && y == typeInt {
+			return typeTime, nil
+		}
+	case "MOD":
+		if x == typeInt && y == typeInt {
+			return typeInt, nil
+		}
+	}
+	return 0, fmt.Errorf("operator %s is not defined for %s and %s", op, x, y)
+}
+
+func (p *parser) unaryExpression() (expr, error) {
+	tok := p.peek()
+
+	if (tok.kind == tokKeyword && tok.text == "NOT") || (tok.kind == tokOp && tok.text == "-") {
+		p.next()
+		x, err := p.unaryExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.text == "NOT" && x.typ() != typeBool {
+			return nil, errorAt(tok.pos, "NOT is not defined for %s", x.typ())
+		}
+		if tok.text == "-" && x.typ() == typeBool {
+			return nil, errorAt(tok.pos, "negation is not defined for BOOL")
+		}
+
+		// negative literals stay constant
+		if l, ok := x.(*literal); ok && tok.text == "-" {
+			return &literal{t: l.t, v: -l.v}, nil
+		}
+		return &unary{op: tok.text, x: x, t: x.typ(), pos: tok.pos}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case tokInt:
+		p.next()
+		v, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, errorAt(tok.pos, "bad integer %s", tok.text)
+		}
+		return &literal{t: typeInt, v: v}, nil
+
+	case tokTime:
+		p.next()
+		d, err := parseTime(tok.text)
+		if err != nil {
+			return nil, errorAt(tok.pos, "bad time literal T#%s", tok.text)
+		}
+		return &literal{t: typeTime, v: int64(d)}, nil
+
+	case tokKeyword:
+		switch tok.text {
+		case "TRUE", "FALSE":
+			p.next()
+			return &literal{t: typeBool, v: boolValue(tok.text == "TRUE")}, nil
+		}
+
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			e, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expectOp(")")
+		}
+
+	case tokIdent:
+		return p.reference()
+	}
+
+	return nil, errorAt(tok.pos, "unexpected %q in expression", tok.text)
+}
+
+// variable or function block field
+func (p *parser) reference() (expr, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	if v, found := p.vars[strings.ToUpper(name.text)]; found {
+		return &varRef{v: v}, nil
+	}
+
+	b, found := p.blocks[strings.ToUpper(name.text)]
+	if !found {
+		return nil, errorAt(name.pos, "unknown variable %s", name.text)
+	}
+
+	if err := p.expectOp("."); err != nil {
+		return nil, err
+	}
+	field, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	fieldName := strings.ToUpper(field.text)
+	t, found := b.spec.field(fieldName)
+	if !found {
+		return nil, errorAt(field.pos, "%s has no field %s", b.kind, field.text)
+	}
+
+	return &fieldRef{b: b, field: fieldName, t: t}, nil
+}
+
+func (p *parser) lookup(name string) (any, bool) {
+	upper := strings.ToUpper(name)
+	if v, found := p.vars[upper]; found {
+		return v, true
+	}
+	if b, found := p.blocks[upper]; found {
+		return b, true
+	}
+	return nil, false
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) peekAt(offset int) token {
+	return p.toks[min(p.i+offset, len(p.toks)-1)]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	tok := p.peek()
+	return tok.kind == tokKeyword && tok.text == kw
+}
+
+func (p *parser) isOp(op string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && tok.text == op
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	tok := p.next()
+	if tok.kind != tokKeyword || tok.text != kw {
+		return errorAt(tok.pos, "expected %s, got %q", kw, tok.text)
+	}
+	return nil
+}
+
+func (p *parser) expectOp(op string) error {
+	tok := p.next()
+	if tok.kind != tokOp || tok.text != op {
+		return errorAt(tok.pos, "expected %q, got %q", op, tok.text)
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (token, error) {
+	tok := p.next()
+	if tok.kind != tokIdent {
+		return token{}, errorAt(tok.pos, "expected name, got %q", tok.text)
+	}
+	return tok, nil
+}
+
+func isConstant(e expr) bool {
+	_, ok := e.(*literal)
+	return ok
+}
+
+// iec time literal body like 1s500ms, 1.5s or 1d2h
+func parseTime(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, "_", ""))
+
+	var days time.Duration
+	if m := daysRe.FindStringSubmatch(s); m != nil {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || n > math.MaxInt64/int64(24*time.Hour) {
+			return 0, fmt.Errorf("bad days %s", m[1])
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		s = m[2]
+		if s == "" {
+			return days, nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
+}
+
+func unlabeled(end []string) []string {
+	res := make([]string, 0, len(end))
+	for _, kw := range end {
+		if kw != "label" {
+			res = append(res, kw)
+		}
+	}
+	return res
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
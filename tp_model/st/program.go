@@ -0,0 +1,222 @@
+// Package st interprets subset of IEC 61131-3 Structured Text, programs run as plc controllers.
+//
+// Supported are BOOL, INT (DINT) and TIME variables, IF, CASE and FOR statements and
+// TON, TOF, R_TRIG, F_TRIG, SR and RS function blocks. BOOL variables are bound to line
+// sensors with AT %I 'ns:1, i:1' and to outputs and actuators with AT %Q 'ns:1, i:7'.
+package st
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Razzle131/line316/tp_model/plc"
+)
+
+var (
+	ErrCompile   = errors.New("compile error")
+	ErrRuntime   = errors.New("runtime error")
+	ErrNoProgram = errors.New("no program uploaded")
+)
+
+type Variable struct {
+	Name    string
+	Type    string // elementary type or function block type
+	Binding string // %I or %Q with node id, empty if not bound
+	Value   any    // bool, int64, time.Duration or field -> value for function blocks
+}
+
+// compiled program, it is plc controller keeping variables between scans
+type Program struct {
+	name   string
+	source string
+	order  []any // *varDecl and *blockDecl in declaration order
+	nVars  int
+	body   []stmt
+
+	mu    sync.Mutex
+	m     *machine
+	fault error // runtime error stopping execution until reset
+}
+
+func Compile(src string) (*Program, error) {
+	p, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	p.source = src
+	p.Reset()
+
+	return p, nil
+}
+
+func (p *Program) Name() string {
+	return p.name
+}
+
+func (p *Program) Source() string {
+	return p.source
+}
+
+// sets variables to initial values and clears fault, like plc cold start
+func (p *Program) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := &machine{vars: make([]int64, p.nVars)}
+	for _, decl := range p.order {
+		switch d := decl.(type) {
+		case *varDecl:
+			if d.init != nil {
+				m.vars[d.slot] = d.init.(*literal).v
+			}
+		case *blockDecl:
+			m.blocks = append(m.blocks, d.spec.new())
+		}
+	}
+
+	p.m = m
+	p.fault = nil
+}
+
+// runs program once, faulted program keeps all outputs reset
+func (p *Program) Scan(in plc.ProcessImage) plc.Outputs {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fault != nil {
+		return plc.Outputs{}
+	}
+
+	p.m.now = in.Time
+	for _, decl := range p.order {
+		v, ok := decl.(*varDecl)
+		if !ok || v.dir != "%I" {
+			continue
+		}
+		if v.typ == typeInt {
+			value, found := in.Registers[v.at]
+			if !found {
+				p.fault = fmt.Errorf("%w: %s: register %q not found", ErrRuntime, v.pos, v.at)
+				return plc.Outputs{}
+			}
+			p.m.vars[v.slot] = value
+			continue
+		}
+
+		value, found := in.Inputs[v.at]
+		if !found {
+			p.fault = fmt.Errorf("%w: %s: input %q not found", ErrRuntime, v.pos, v.at)
+			return plc.Outputs{}
+		}
+		p.m.vars[v.slot] = boolValue(value)
+	}
+
+	p.m.loops = maxLoopIterations
+	if err := p.m.execAll(p.body); err != nil {
+		p.fault = err
+		return plc.Outputs{}
+	}
+
+	out := make(plc.Outputs)
+	for _, decl := range p.order {
+		if v, ok := decl.(*varDecl); ok && v.dir == "%Q" {
+			out[v.at] = p.m.vars[v.slot] != 0
+		}
+	}
+
+	return out
+}
+
+// runtime error which stopped program, nil if program runs
+func (p *Program) Fault() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fault
+}
+
+// current values of all variables in declaration order
+func (p *Program) Variables() []Variable {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := make([]Variable, 0, len(p.order))
+	for _, decl := range p.order {
+		switch d := decl.(type) {
+		case *varDecl:
+			v := Variable{
+				Name:  d.name,
+				Type:  d.typ.String(),
+				Value: d.typ.value(p.m.vars[d.slot]),
+			}
+			if d.at != "" {
+				v.Binding = d.dir + " " + d.at
+			}
+			res = append(res, v)
+
+		case *blockDecl:
+			b := p.m.blocks[d.slot]
+			fields := make(map[string]any, len(d.spec.fields))
+			for _, name := range d.spec.fields {
+				t, _ := d.spec.field(name)
+				fields[name] = t.value(b.get(name))
+			}
+			res = append(res, Variable{Name: d.name, Type: d.kind, Value: fields})
+		}
+	}
+
+	return res
+}
+
+// bound node ids by direction, sorted
+func (p *Program) Bindings() (inputs, outputs []string) {
+	for _, decl := range p.order {
+		v, ok := decl.(*varDecl)
+		if !ok {
+			continue
+		}
+		switch v.dir {
+		case "%I":
+			inputs = append(inputs, v.at)
+		case "%Q":
+			outputs = append(outputs, v.at)
+		}
+	}
+	sort.Strings(inputs)
+	sort.Strings(outputs)
+
+	return inputs, outputs
+}
+
+// uploaded program of one line
+type Store struct {
+	mu   sync.Mutex
+	prog *Program
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+func (s *Store) Set(p *Program) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prog = p
+}
+
+func (s *Store) Get() (*Program, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.prog == nil {
+		return nil, ErrNoProgram
+	}
+	return s.prog, nil
+}
+
+// controller name of program in plc status
+func ControllerName(p *Program) string {
+	return "st:" + strings.ToLower(p.name)
+}
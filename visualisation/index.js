@@ -1,12 +1,48 @@
 const REFRESH_INTERVAL_MS = 500; // частота опроса
 
+// index.html?line=<id> shows line created via POST /lines
+const LINE_ID = new URLSearchParams(window.location.search).get("line");
+const BASE_URL = LINE_ID ? `http://localhost:8080/lines/${LINE_ID}` : "http://localhost:8080";
+
+// replayed moment in ms from history start, null shows live line
+let replayOffset = null
+let replayPlaying = false
+
 async function updateLoop() {
   try {
-    gripper = await fetchGripper()
-    carousel = await fetchCarousel()
-    start = await fetchStart()
-    packaging = await fetchPackaging()
-    sorting = await fetchSorting()
+    history = await fetchHistory()
+    updateScrubber(history)
+
+    if (replayOffset == null) {
+        gripper = await fetchGripper()
+        carousel = await fetchCarousel()
+        start = await fetchStart()
+        packaging = await fetchPackaging()
+        sorting = await fetchSorting()
+        lights = await fetchLights()
+    } else {
+        // past state has the same parts as live one
+        at = new Date(Date.parse(history.start) + replayOffset)
+        state = await fetchState(at)
+        gripper = {
+            puckSlot: state.gripper.puck,
+            curHorizontalPosition: state.gripper.horizontalPosition,
+            curVerticalPosition: state.gripper.verticalPosition,
+        }
+        carousel = { slots: state.carousel.slots }
+        start = { puckSlot: state.start.puck }
+        packaging = { puckSlot: state.packaging.puck }
+        sorting = { puckSlot: state.sorting.puck }
+        lights = {
+            green: state.actuators["ns:4, i:34"],
+            yellow: state.actuators["ns:4, i:35"],
+            red: state.actuators["ns:4, i:36"],
+            startButton: state.actuators["ns:1, i:5"],
+            resetButton: state.actuators["ns:1, i:6"],
+        }
+    }
+    alarms = await fetchAlarms()
+    simulation = await fetchSimulation()
 
     gripper_puck = document.getElementById("gripper-puck")
     gripper_hor_pos = document.getElementById("gripper-hor-pos")
@@ -65,13 +101,68 @@ async function updateLoop() {
         sort_slot.style.background = "black"
     }
 
+    // lights
+    setLamp("light-red", lights.red, "red")
+    setLamp("light-yellow", lights.yellow, "yellow")
+    setLamp("light-green", lights.green, "limegreen")
+    setLamp("lamp-start", lights.startButton, "limegreen")
+    setLamp("lamp-reset", lights.resetButton, "deepskyblue")
+
+    // alarms
+    alarm_list = document.getElementById("alarm-list")
+    alarm_list.innerHTML = ""
+    for (let i = 0; i < alarms.length; i++) {
+        item = document.createElement("li")
+        item.textContent = `[${alarms[i].severity}] ${alarms[i].message}`
+        if (alarms[i].isActive && !alarms[i].isAcknowledged) {
+            item.style.color = "red"
+        } else if (alarms[i].isActive) {
+            item.style.color = "orange"
+        } else {
+            item.style.color = "gray"
+        }
+        alarm_list.appendChild(item)
+    }
+
+    // simulation paused by breakpoint, step or by hand
+    simulation_block = document.getElementById("simulation")
+    simulation_status = document.getElementById("simulation-status")
+    if (simulation.paused) {
+        text = "Пауза"
+        if (simulation.breakpoint != null) {
+            text += `: точка останова ${simulation.breakpoint.id} (${simulation.breakpoint.condition})`
+        } else if (simulation.reason == "step") {
+            text += ": шаг выполнен"
+        }
+        simulation_status.textContent = text
+        simulation_block.style.visibility = "visible"
+    } else {
+        simulation_block.style.visibility = "hidden"
+    }
+
   } catch (e) {
     console.error("Failed to update state", e);
   }
 }
 
+async function fetchHistory() {
+    const response = await fetch(`${BASE_URL}/vis/history`);
+    if (!response.ok) {
+        console.log(response.status, response.statusText)
+    }
+    return response.json();
+}
+
+async function fetchState(at) {
+    const response = await fetch(`${BASE_URL}/vis/state?at=${encodeURIComponent(at.toISOString())}`);
+    if (!response.ok) {
+        console.log(response.status, response.statusText)
+    }
+    return response.json();
+}
+
 async function fetchGripper() {
-    const response = await fetch(`http://localhost:8080/vis/gripper`);
+    const response = await fetch(`${BASE_URL}/vis/gripper`);
     if (!response.ok) {
         console.log(response.status, response.statusText)
     }
@@ -79,7 +170,7 @@ async function fetchGripper() {
 }
 
 async function fetchCarousel() {
-    const response = await fetch(`http://localhost:8080/vis/carousel`);
+    const response = await fetch(`${BASE_URL}/vis/carousel`);
     if (!response.ok) {
         console.log(response.status, response.statusText)
     }
@@ -87,7 +178,7 @@ async function fetchCarousel() {
 }
 
 async function fetchStart() {
-    const response = await fetch(`http://localhost:8080/vis/start`);
+    const response = await fetch(`${BASE_URL}/vis/start`);
     if (!response.ok) {
         console.log(response.status, response.statusText)
     }
@@ -95,7 +186,7 @@ async function fetchStart() {
 }
 
 async function fetchPackaging() {
-    const response = await fetch(`http://localhost:8080/vis/packaging`);
+    const response = await fetch(`${BASE_URL}/vis/packaging`);
     if (!response.ok) {
         console.log(response.status, response.statusText)
     }
@@ -103,12 +194,92 @@ async function fetchPackaging() {
 }
 
 async function fetchSorting() {
-    const response = await fetch(`http://localhost:8080/vis/sorting`);
+    const response = await fetch(`${BASE_URL}/vis/sorting`);
     if (!response.ok) {
         console.log(response.status, response.statusText)
     }
     return response.json();
 }
 
+async function fetchLights() {
+    const response = await fetch(`${BASE_URL}/vis/lights`);
+    if (!response.ok) {
+        console.log(response.status, response.statusText)
+    }
+    return response.json();
+}
+
+async function fetchAlarms() {
+    const response = await fetch(`${BASE_URL}/vis/alarms`);
+    if (!response.ok) {
+        console.log(response.status, response.statusText)
+    }
+    return response.json();
+}
+
+async function fetchSimulation() {
+    const response = await fetch(`${BASE_URL}/vis/simulation`);
+    if (!response.ok) {
+        console.log(response.status, response.statusText)
+    }
+    return response.json();
+}
+
+// scrubber covers recorded history, it follows the end while live
+function updateScrubber(history) {
+    replay_block = document.getElementById("replay")
+    if (!history.enabled || history.start == null) {
+        replay_block.style.visibility = "hidden"
+        return
+    }
+    replay_block.style.visibility = "visible"
+
+    scrubber = document.getElementById("replay-scrubber")
+    recorded = Date.parse(history.end) - Date.parse(history.start)
+    scrubber.max = recorded
+
+    if (replayOffset != null && replayPlaying) {
+        replayOffset += REFRESH_INTERVAL_MS
+    }
+    if (replayOffset != null && replayOffset >= recorded) {
+        replayOffset = null // replay caught up with the line
+        replayPlaying = false
+    }
+
+    offset = replayOffset == null ? recorded : replayOffset
+    scrubber.value = offset
+    sinceOrigin = (Date.parse(history.start) + offset - Date.parse(history.origin)) / 1000
+    document.getElementById("replay-time").textContent = `t = ${sinceOrigin.toFixed(2)} с`
+    document.getElementById("replay-live").disabled = replayOffset == null
+    document.getElementById("replay-play").textContent = replayPlaying ? "Пауза" : "Воспроизвести"
+}
+
+function scrubTo(value) {
+    replayOffset = Number(value)
+    updateLoop()
+}
+
+function goLive() {
+    replayOffset = null
+    replayPlaying = false
+    updateLoop()
+}
+
+function togglePlay() {
+    if (replayOffset == null) {
+        return
+    }
+    replayPlaying = !replayPlaying
+    updateLoop()
+}
+
+function setLamp(id, isOn, color) {
+    if (isOn) {
+        document.getElementById(id).style.background = color
+    } else {
+        document.getElementById(id).style.background = "gray"
+    }
+}
+
 setInterval(updateLoop, REFRESH_INTERVAL_MS);
 updateLoop()
\ No newline at end of file